@@ -19,20 +19,58 @@
 package bbcode
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
-	"github.com/StefanSchroeder/Golang-Roman"
 	"github.com/bieber/manuscript/parser"
 	"github.com/bieber/manuscript/renderers"
+	"github.com/bieber/manuscript/util"
 	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 // Renderer provides a Render method to render the given document to
 // bbcode text.
 type Renderer struct {
-	document parser.Document
-	buffer   bytes.Buffer
+	width      int
+	maxChars   int
+	postBreak  string
+	labels     util.Labels
+	sceneBreak renderers.SceneSeparator
+	document   parser.Document
+	buffer     *poster
+}
+
+// Options lists the options accepted by New.
+var Options = append(
+	[]renderers.OptionSpec{
+		{
+			Name:        "wrap",
+			Default:     "0",
+			Description: "Column to wrap paragraphs at, or 0 for no wrapping",
+		},
+		{
+			Name:        "maxChars",
+			Default:     "0",
+			Description: "Longest post to split the output into, or 0 for one",
+		},
+		{
+			Name:        "postBreak",
+			Default:     "=== POST BREAK ===",
+			Description: "Text to separate posts with",
+		},
+	},
+	append(
+		renderers.NewSceneSeparator("------").Options(),
+		util.LabelOptions...,
+	)...,
+)
+
+func init() {
+	renderers.Register("bbcode", New, Options...)
 }
 
 // New constructs a new Renderer for the given document and
@@ -41,12 +79,56 @@ func New(
 	document parser.Document,
 	options map[string]string,
 ) (renderers.Renderer, error) {
-	return &Renderer{document: document}, nil
+	renderer := Renderer{
+		postBreak:  "=== POST BREAK ===",
+		labels:     util.DefaultLabels,
+		sceneBreak: renderers.NewSceneSeparator("------"),
+		document:   document,
+	}
+
+	for k, v := range options {
+		switch k {
+		case "wrap":
+			width, err := strconv.Atoi(v)
+			if err != nil || width < 0 {
+				return nil, fmt.Errorf("Invalid bbcode wrap width %s", v)
+			}
+			renderer.width = width
+		case "maxChars":
+			maxChars, err := strconv.Atoi(v)
+			if err != nil || maxChars < 0 {
+				return nil, fmt.Errorf("Invalid bbcode post size %s", v)
+			}
+			renderer.maxChars = maxChars
+		case "postBreak":
+			renderer.postBreak = v
+		case "sceneBreak", "sceneBreakAlignment":
+			if err := renderer.sceneBreak.Set(k, v); err != nil {
+				return nil, err
+			}
+		case "partLabel", "chapterLabel", "prologueLabel",
+			"numberStyle", "partNumberStyle", "labelSeparator":
+			if err := renderer.labels.Set(k, v); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("Invalid bbcode option %s", k)
+		}
+	}
+
+	return &renderer, nil
 }
 
 // Render writes the requested document out to the specified io.Writer
-// as bbcode text.
+// as bbcode text.  The text is written out as it's rendered rather than
+// built up in memory, so even a very long story only needs a small
+// buffer, or at most one post's worth when it's split into posts.
 func (r *Renderer) Render(fout io.Writer) error {
+	r.buffer = &poster{
+		out:       bufio.NewWriter(fout),
+		maxChars:  r.maxChars,
+		delimiter: r.postBreak,
+	}
 	for _, p := range r.document.Parts {
 		err := r.renderPart(p)
 		if err != nil {
@@ -54,16 +136,46 @@ func (r *Renderer) Render(fout io.Writer) error {
 		}
 	}
 
-	_, err := r.buffer.WriteTo(fout)
-	return err
+	if len(r.document.AfterMatter) != 0 {
+		err := r.renderAfterword()
+		if err != nil {
+			return err
+		}
+	}
+
+	return r.buffer.Flush()
+}
+
+func (r *Renderer) renderAfterword() error {
+	_, err := r.buffer.WriteString("[b]Afterword[/b]\n\n")
+	if err != nil {
+		return err
+	}
+
+	for _, p := range r.document.AfterMatter {
+		if !p.RenderedBy("bbcode") {
+			continue
+		}
+
+		err := r.renderParagraph(p)
+		if err != nil {
+			return err
+		}
+
+		_, err = r.buffer.WriteString("\n\n")
+		if err != nil {
+			return err
+		}
+		if err = r.buffer.mark(paragraphEnd); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (r *Renderer) renderPart(part parser.Part) error {
 	if !part.Anonymous {
-		text := "Part " + roman.Roman(part.Number)
-		if part.Title != "" {
-			text += ": " + part.Title
-		}
+		text := r.labels.PartLabel(part.Number, part.Title)
 
 		_, err := r.buffer.WriteString("[b]" + text + "[/b]\n\n")
 		if err != nil {
@@ -83,17 +195,9 @@ func (r *Renderer) renderPart(part parser.Part) error {
 
 func (r *Renderer) renderChapter(chapter parser.Chapter) error {
 	if !chapter.Anonymous {
-		text := ""
+		text := r.labels.ChapterLabel(chapter.Number, chapter.Title)
 		if chapter.Prologue {
-			text = "Prologue"
-			if chapter.Title != "" {
-				text += ": " + chapter.Title
-			}
-		} else {
-			text = fmt.Sprintf("Chapter %d", chapter.Number)
-			if chapter.Title != "" {
-				text += ": " + chapter.Title
-			}
+			text = r.labels.PrologueLabel(chapter.Title)
 		}
 
 		_, err := r.buffer.WriteString("[b]" + text + "[/b]\n\n")
@@ -102,6 +206,13 @@ func (r *Renderer) renderChapter(chapter parser.Chapter) error {
 		}
 	}
 
+	if chapter.Epigraph != nil {
+		err := r.renderEpigraph(*chapter.Epigraph)
+		if err != nil {
+			return err
+		}
+	}
+
 	for i, s := range chapter.Scenes {
 		err := r.renderScene(s)
 		if err != nil {
@@ -109,18 +220,76 @@ func (r *Renderer) renderChapter(chapter parser.Chapter) error {
 		}
 
 		if i != len(chapter.Scenes)-1 {
-			_, err := r.buffer.WriteString("------\n\n")
+			// A post that ends here leaves the scene break, and its
+			// label, to start the next one.
+			if err := r.buffer.mark(sceneEnd); err != nil {
+				return err
+			}
+
+			err := r.renderSceneBreak(s.BreakLabel)
 			if err != nil {
 				return err
 			}
 		}
 	}
 
-	return nil
+	return r.buffer.mark(chapterEnd)
+}
+
+func (r *Renderer) renderSceneBreak(label string) error {
+	text := ""
+	if !r.sceneBreak.Blank() {
+		text = r.sceneBreak.Glyph
+		if tag := alignmentTag(r.sceneBreak.Alignment); tag != "" {
+			text = "[" + tag + "]" + text + "[/" + tag + "]"
+		}
+		text += "\n"
+	}
+	text += "\n"
+
+	if label != "" {
+		text += "[center][i]" + label + "[/i][/center]\n\n"
+	}
+
+	_, err := r.buffer.WriteString(text)
+	return err
+}
+
+func (r *Renderer) renderEpigraph(epigraph parser.Epigraph) error {
+	text := "[i]" + epigraph.Text + "[/i]\n"
+	if epigraph.Attribution != "" {
+		text += "— " + epigraph.Attribution + "\n"
+	}
+
+	_, err := r.buffer.WriteString(text + "\n")
+	return err
 }
 
 func (r *Renderer) renderScene(scene parser.Scene) error {
-	for _, p := range scene.Paragraphs {
+	for _, s := range scene.Sections {
+		err := r.renderSection(s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Renderer) renderSection(section parser.Section) error {
+	if section.Title != "" {
+		_, err := r.buffer.WriteString("[b]" + section.Title + "[/b]\n\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, p := range section.Paragraphs {
+		// Paragraphs for other renderers are left out entirely, along
+		// with the break after them.
+		if !p.RenderedBy("bbcode") {
+			continue
+		}
+
 		err := r.renderParagraph(p)
 		if err != nil {
 			return err
@@ -130,31 +299,155 @@ func (r *Renderer) renderScene(scene parser.Scene) error {
 		if err != nil {
 			return err
 		}
+		if err = r.buffer.mark(paragraphEnd); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
 func (r *Renderer) renderParagraph(paragraph parser.Paragraph) error {
-	for _, e := range paragraph.Text {
-		err := r.renderElement(e)
-		if err != nil {
+	if verse, ok := paragraph.Verse(); ok {
+		return r.renderVerse(verse)
+	}
+	if raw, ok := paragraph.Raw(); ok {
+		_, err := r.buffer.WriteString(raw.Content)
+		return err
+	}
+	if block, ok := paragraph.Conditional(); ok {
+		return r.renderParagraphs(block.Paragraphs)
+	}
+	if spoiler, ok := paragraph.Spoiler(); ok {
+		return r.renderSpoiler(spoiler)
+	}
+	if image, ok := paragraph.Image(); ok {
+		text := "[img]" + image.Path + "[/img]"
+		if image.Caption != "" {
+			text += "\n[i]" + image.Caption + "[/i]"
+		}
+		_, err := r.buffer.WriteString(text)
+		return err
+	}
+
+	tag := alignmentTag(paragraph.Alignment)
+	if tag != "" {
+		if _, err := r.buffer.WriteString("[" + tag + "]"); err != nil {
+			return err
+		}
+	}
+
+	if r.width != 0 {
+		if _, err := r.buffer.WriteString(r.wrap(paragraph.Text)); err != nil {
+			return err
+		}
+	} else {
+		for _, e := range paragraph.Text {
+			err := r.renderElement(e)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if tag != "" {
+		if _, err := r.buffer.WriteString("[/" + tag + "]"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// alignmentTag returns the tag that aligns text as given, if any.
+func alignmentTag(alignment parser.Alignment) string {
+	switch alignment {
+	case parser.CenterAlignment:
+		return "center"
+	case parser.RightAlignment:
+		return "right"
+	}
+	return ""
+}
+
+// renderParagraphs writes out the paragraphs of a block directive,
+// separated the same way as the paragraphs of a section.  The section
+// loop writes the break after the block as a whole, so only the breaks
+// between its paragraphs are written here.
+func (r *Renderer) renderParagraphs(paragraphs []parser.Paragraph) error {
+	for i, p := range paragraphs {
+		if i != 0 {
+			if _, err := r.buffer.WriteString("\n\n"); err != nil {
+				return err
+			}
+		}
+		if err := r.renderParagraph(p); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+func (r *Renderer) renderSpoiler(spoiler parser.SpoilerBlock) error {
+	open := "[spoiler]"
+	if spoiler.Title != "" {
+		open = "[spoiler=" + spoiler.Title + "]"
+	}
+
+	_, err := r.buffer.WriteString(open)
+	if err == nil {
+		err = r.renderParagraphs(spoiler.Paragraphs)
+	}
+	if err == nil {
+		_, err = r.buffer.WriteString("[/spoiler]")
+	}
+	return err
+}
+
+func (r *Renderer) renderVerse(verse parser.VerseBlock) error {
+	_, err := r.buffer.WriteString("[pre]")
+	for i, line := range verse.Lines {
+		if i != 0 && err == nil {
+			_, err = r.buffer.WriteString("\n")
+		}
+		for _, e := range line {
+			if err == nil {
+				err = r.renderElement(e)
+			}
+		}
+	}
+	if err == nil {
+		_, err = r.buffer.WriteString("[/pre]")
+	}
+	return err
+}
+
 func (r *Renderer) renderElement(element parser.DocumentElement) error {
-	var err error
+	open, text, close := elementTags(element)
+	_, err := r.buffer.WriteString(open + text + close)
+	return err
+}
+
+// elementTags returns the text of an element along with the tags that
+// open and close its style.
+func elementTags(element parser.DocumentElement) (open, text, close string) {
 	switch e := element.(type) {
 	case parser.PlainText:
-		_, err = r.buffer.WriteString(string(e))
+		return "", string(e), ""
 	case parser.ItalicText:
-		_, err = r.buffer.WriteString("[i]" + string(e) + "[/i]")
+		return "[i]", string(e), "[/i]"
 	case parser.BoldText:
-		_, err = r.buffer.WriteString("[b]" + string(e) + "[/b]")
+		return "[b]", string(e), "[/b]"
 	case parser.BoldItalicText:
-		_, err = r.buffer.WriteString("[b][i]" + string(e) + "[/i][/b]")
+		return "[b][i]", string(e), "[/i][/b]"
+	case parser.Footnote:
+		return "", " (" + string(e) + ")", ""
+	case parser.UnderlineText:
+		return "[u]", string(e), "[/u]"
+	case parser.StrikethroughText:
+		open, text, close = elementTags(e.Text)
+		return "[s]" + open, text, close + "[/s]"
+	case parser.ColoredText:
+		open, text, close = elementTags(e.Text)
+		return "[color=" + e.Color + "]" + open, text, close + "[/color]"
 	default:
 		panic(
 			errors.New(
@@ -162,6 +455,53 @@ func (r *Renderer) renderElement(element parser.DocumentElement) error {
 			),
 		)
 	}
+}
 
-	return err
+// wrap lays out a paragraph's text in lines no wider than the
+// renderer's width, breaking only at spaces.  Tags don't count toward
+// the width.  A styled span that's broken across lines is closed at the
+// end of one line and opened again at the start of the next, so that
+// no tag is ever left open across a line break.
+func (r *Renderer) wrap(elements []parser.DocumentElement) string {
+	buf := bytes.Buffer{}
+	lineWidth, space := 0, false
+	for _, e := range elements {
+		open, text, close := elementTags(e)
+		opened := false
+		for i, word := range strings.Split(text, " ") {
+			if i != 0 {
+				space = true
+			}
+			if word == "" {
+				continue
+			}
+
+			wordWidth := utf8.RuneCountInString(word)
+			if space && lineWidth != 0 {
+				if lineWidth+1+wordWidth > r.width {
+					if opened {
+						buf.WriteString(close)
+						opened = false
+					}
+					buf.WriteString("\n")
+					lineWidth = 0
+				} else {
+					buf.WriteString(" ")
+					lineWidth++
+				}
+			}
+			space = false
+
+			if !opened {
+				buf.WriteString(open)
+				opened = true
+			}
+			buf.WriteString(word)
+			lineWidth += wordWidth
+		}
+		if opened {
+			buf.WriteString(close)
+		}
+	}
+	return buf.String()
 }
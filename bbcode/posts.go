@@ -0,0 +1,152 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bbcode
+
+import (
+	"bufio"
+	"unicode/utf8"
+)
+
+// The places a post can end, from the least to the most preferred.
+const (
+	paragraphEnd = iota + 1
+	sceneEnd
+	chapterEnd
+)
+
+// poster collects the renderer's output and splits it into posts of no
+// more than maxChars characters each, for forums that limit the length
+// of a post.  Posts only end where the renderer has marked the end of a
+// paragraph, scene, or chapter, and the end of a chapter is preferred
+// to the end of a scene, which is preferred to the end of a paragraph.
+// Only the post being filled is held in memory.
+//
+// With a maxChars of 0, everything is written straight through.
+type poster struct {
+	out       *bufio.Writer
+	maxChars  int
+	delimiter string
+	post      []byte
+	ends      []postEnd
+}
+
+// postEnd is a place in the current post that it may end, given as a
+// byte offset into the post.
+type postEnd struct {
+	offset int
+	level  int
+}
+
+func (p *poster) WriteString(s string) (int, error) {
+	if p.maxChars == 0 {
+		return p.out.WriteString(s)
+	}
+
+	p.post = append(p.post, s...)
+	return len(s), nil
+}
+
+// mark notes that a paragraph, scene, or chapter has just ended, and
+// writes out any posts that are full.
+func (p *poster) mark(level int) error {
+	if p.maxChars == 0 {
+		return nil
+	}
+	if err := p.split(); err != nil {
+		return err
+	}
+
+	// A chapter ends along with its last scene and paragraph, so only
+	// the most preferred end is kept.
+	offset := len(p.post)
+	if n := len(p.ends); n != 0 && p.ends[n-1].offset == offset {
+		if level > p.ends[n-1].level {
+			p.ends[n-1].level = level
+		}
+		return nil
+	}
+	p.ends = append(p.ends, postEnd{offset: offset, level: level})
+	return nil
+}
+
+// Flush writes out whatever's left of the last post.
+func (p *poster) Flush() error {
+	if p.maxChars != 0 {
+		if err := p.split(); err != nil {
+			return err
+		}
+		if _, err := p.out.Write(p.post); err != nil {
+			return err
+		}
+	}
+	return p.out.Flush()
+}
+
+// split writes out posts for as long as the text collected is too long
+// to fit in one.
+func (p *poster) split() error {
+	for utf8.RuneCount(p.post) > p.maxChars && len(p.ends) != 0 {
+		best := postEnd{}
+		for _, end := range p.ends {
+			if utf8.RuneCount(p.post[:end.offset]) > p.maxChars {
+				break
+			}
+			if end.level >= best.level {
+				best = end
+			}
+		}
+
+		// A paragraph too long to fit in a post can't be broken up, so
+		// it gets a post all to itself, as long as there's something
+		// after it to start the next post with.
+		if best.offset == 0 {
+			best = p.ends[0]
+			if best.offset == len(p.post) {
+				return nil
+			}
+		}
+
+		if err := p.emit(best.offset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emit writes out the current post up to offset, followed by the
+// delimiter, and starts the next post with whatever's left.
+func (p *poster) emit(offset int) error {
+	if _, err := p.out.Write(p.post[:offset]); err != nil {
+		return err
+	}
+	if _, err := p.out.WriteString(p.delimiter + "\n\n"); err != nil {
+		return err
+	}
+
+	p.post = append([]byte{}, p.post[offset:]...)
+	ends := []postEnd{}
+	for _, end := range p.ends {
+		if end.offset > offset {
+			end.offset -= offset
+			ends = append(ends, end)
+		}
+	}
+	p.ends = ends
+	return nil
+}
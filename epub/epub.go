@@ -0,0 +1,656 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package epub
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/bieber/manuscript/parser"
+	"github.com/bieber/manuscript/renderers"
+	"github.com/bieber/manuscript/util"
+	"io"
+	"io/ioutil"
+	"mime"
+	"path/filepath"
+)
+
+const xhtmlDocType = `<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.1//EN" ` +
+	`"http://www.w3.org/TR/xhtml11/DTD/xhtml11.dtd">` + "\n"
+
+// Renderer provides a Render method to render the given document to
+// an EPUB file.
+type Renderer struct {
+	dialogueStyle *util.QuoteStyle
+	labels        util.Labels
+	sceneBreak    renderers.SceneSeparator
+	document      parser.Document
+	zip           *zip.Writer
+	pages         []page
+	nav           []navPoint
+	images        map[string]string
+	imageItems    []opfItem
+}
+
+// page is a single XHTML file in the finished book, in reading order.
+type page struct {
+	id       string
+	fileName string
+}
+
+// Options lists the options accepted by New.
+var Options = append(
+	[]renderers.OptionSpec{
+		{
+			Name:        "dialogueStyle",
+			Default:     "",
+			Description: "Dialogue quotes: english, german, french or none",
+		},
+	},
+	append(
+		renderers.NewSceneSeparator("* * *").Options(),
+		util.LabelOptions...,
+	)...,
+)
+
+func init() {
+	renderers.Register("epub", New, Options...)
+}
+
+// New constructs a new Renderer for the given document and
+// command-line arguments.
+func New(
+	document parser.Document,
+	options map[string]string,
+) (renderers.Renderer, error) {
+	renderer := Renderer{
+		labels:     util.DefaultLabels,
+		sceneBreak: renderers.NewSceneSeparator("* * *"),
+		document:   document,
+	}
+
+	for k, v := range options {
+		switch k {
+		case "dialogueStyle":
+			style, err := util.ParseQuoteStyle(v)
+			if err != nil {
+				return nil, err
+			}
+			renderer.dialogueStyle = style
+		case "sceneBreak", "sceneBreakAlignment":
+			if err := renderer.sceneBreak.Set(k, v); err != nil {
+				return nil, err
+			}
+		case "partLabel", "chapterLabel", "prologueLabel",
+			"numberStyle", "partNumberStyle", "labelSeparator":
+			if err := renderer.labels.Set(k, v); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("Invalid EPUB option %s", k)
+		}
+	}
+
+	return &renderer, nil
+}
+
+// Render writes the requested document out to the specified io.Writer
+// as an EPUB file.
+func (r *Renderer) Render(fout io.Writer) error {
+	r.zip = zip.NewWriter(fout)
+	r.pages = []page{}
+	r.nav = []navPoint{}
+	r.images = map[string]string{}
+	r.imageItems = []opfItem{}
+
+	// The mimetype file has to come first in the archive, and it has
+	// to be stored without compression so that it can be read at a
+	// fixed offset.
+	w, err := r.zip.CreateHeader(
+		&zip.FileHeader{Name: "mimetype", Method: zip.Store},
+	)
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(w, "application/epub+zip"); err != nil {
+		return err
+	}
+
+	err = r.writeXML(
+		"META-INF/container.xml",
+		"",
+		container{
+			Xmlns:   "urn:oasis:names:tc:opendocument:xmlns:container",
+			Version: "1.0",
+			RootFiles: []rootFile{
+				{
+					FullPath:  "OEBPS/content.opf",
+					MediaType: "application/oebps-package+xml",
+				},
+			},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	w, err = r.zip.Create("OEBPS/style.css")
+	if err != nil {
+		return err
+	}
+	style := styleSheet
+	if r.document.RightToLeft() {
+		style += rtlStyleSheet
+	}
+	if _, err = io.WriteString(w, style); err != nil {
+		return err
+	}
+
+	if err = r.writeImages(); err != nil {
+		return err
+	}
+
+	if err = r.renderTitlePage(); err != nil {
+		return err
+	}
+	if len(r.document.Dedication) != 0 {
+		if err = r.renderDedication(); err != nil {
+			return err
+		}
+	}
+	for _, p := range r.document.Parts {
+		if err = r.renderPart(p); err != nil {
+			return err
+		}
+	}
+
+	if err = r.writePackage(); err != nil {
+		return err
+	}
+	if err = r.writeNCX(); err != nil {
+		return err
+	}
+
+	return r.zip.Close()
+}
+
+func (r *Renderer) identifier() string {
+	document := r.document
+	return fmt.Sprintf(
+		"manuscript-%x",
+		sha1.Sum([]byte(document.Title+"\n"+document.Byline())),
+	)
+}
+
+// writeImages copies each image in the story into the book, so that
+// the pages can refer to them.
+func (r *Renderer) writeImages() error {
+	for _, image := range r.document.Images() {
+		if _, ok := r.images[image.Path]; ok {
+			continue
+		}
+
+		ext := filepath.Ext(image.Path)
+		mediaType := mime.TypeByExtension(ext)
+		if mediaType == "" {
+			return fmt.Errorf("Unsupported image type %s", image.Path)
+		}
+
+		data, err := ioutil.ReadFile(image.Path)
+		if err != nil {
+			return fmt.Errorf("Invalid image %s", image.Path)
+		}
+
+		id := fmt.Sprintf("image_%d", len(r.imageItems))
+		item := opfItem{ID: id, HREF: id + ext, MediaType: mediaType}
+
+		w, err := r.zip.Create("OEBPS/" + item.HREF)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(data); err != nil {
+			return err
+		}
+		r.images[image.Path] = item.HREF
+		r.imageItems = append(r.imageItems, item)
+	}
+	return nil
+}
+
+func (r *Renderer) writeXML(
+	name string,
+	preamble string,
+	contents interface{},
+) error {
+	w, err := r.zip.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.WriteString(w, xml.Header+preamble); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "\t")
+	return encoder.Encode(contents)
+}
+
+// addPage writes out a new XHTML page with the given title and body
+// contents, and adds it to the end of the book's reading order.
+func (r *Renderer) addPage(
+	title string,
+	children []interface{},
+) (page, error) {
+	id := fmt.Sprintf("page_%d", len(r.pages))
+	pg := page{id: id, fileName: id + ".xhtml"}
+
+	err := r.writeXML(
+		"OEBPS/"+pg.fileName,
+		xhtmlDocType,
+		xhtml{
+			Xmlns: "http://www.w3.org/1999/xhtml",
+			// EPUB 2 has no way to set the page progression, so the
+			// direction only goes on each page's text.
+			Dir: r.document.Direction,
+			Head: header{
+				Title: title,
+				StyleSheet: link{
+					Rel:  "stylesheet",
+					Type: "text/css",
+					HREF: "style.css",
+				},
+			},
+			Body: body{Children: children},
+		},
+	)
+	if err != nil {
+		return pg, err
+	}
+
+	r.pages = append(r.pages, pg)
+	return pg, nil
+}
+
+func (r *Renderer) renderTitlePage() error {
+	document := r.document
+
+	byline := "by " + document.Byline()
+	if document.Type == parser.Novel {
+		byline = "a novel " + byline
+	}
+
+	_, err := r.addPage(
+		document.Title,
+		[]interface{}{
+			h1{Text: document.Title},
+			p{Class: "byline", Text: byline},
+		},
+	)
+	return err
+}
+
+func (r *Renderer) renderDedication() error {
+	children := []interface{}{}
+	for _, line := range r.document.Dedication {
+		children = append(children, p{Text: line})
+	}
+
+	_, err := r.addPage(
+		"Dedication",
+		[]interface{}{div{Class: "dedication", Children: children}},
+	)
+	return err
+}
+
+func (r *Renderer) renderPart(part parser.Part) error {
+	// Chapters in an anonymous part go straight into the top level of
+	// the navigation, otherwise they're nested under the part.
+	nav := &r.nav
+
+	if !part.Anonymous {
+		text := r.labels.PartLabel(part.Number, part.Title)
+		pg, err := r.addPage(text, []interface{}{h1{Text: text}})
+		if err != nil {
+			return err
+		}
+
+		r.nav = append(
+			r.nav,
+			navPoint{
+				ID:      "nav_" + pg.id,
+				Label:   text,
+				Content: navContent{Src: pg.fileName},
+			},
+		)
+		nav = &r.nav[len(r.nav)-1].Children
+	}
+
+	for _, c := range part.Chapters {
+		if err := r.renderChapter(c, nav); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Renderer) renderChapter(
+	chapter parser.Chapter,
+	nav *[]navPoint,
+) error {
+	children := []interface{}{}
+
+	title := r.document.Title
+	if !chapter.Anonymous {
+		if chapter.Prologue {
+			title = r.labels.PrologueLabel(chapter.Title)
+		} else {
+			title = r.labels.ChapterLabel(chapter.Number, chapter.Title)
+		}
+		children = append(children, h2{Text: title})
+	}
+
+	if chapter.Epigraph != nil {
+		children = append(children, r.renderEpigraph(*chapter.Epigraph))
+	}
+
+	for i, s := range chapter.Scenes {
+		children = append(children, r.renderScene(s))
+		if i != len(chapter.Scenes)-1 {
+			children = append(children, r.renderSceneBreak())
+			if s.BreakLabel != "" {
+				children = append(
+					children,
+					p{Class: "scene_label", Text: s.BreakLabel},
+				)
+			}
+		}
+	}
+
+	pg, err := r.addPage(title, children)
+	if err != nil {
+		return err
+	}
+
+	if !chapter.Anonymous {
+		*nav = append(
+			*nav,
+			navPoint{
+				ID:      "nav_" + pg.id,
+				Label:   title,
+				Content: navContent{Src: pg.fileName},
+			},
+		)
+	}
+
+	return nil
+}
+
+func (r *Renderer) renderEpigraph(epigraph parser.Epigraph) div {
+	children := []interface{}{p{Text: epigraph.Text}}
+	if epigraph.Attribution != "" {
+		children = append(
+			children,
+			p{Class: "attribution", Text: "— " + epigraph.Attribution},
+		)
+	}
+
+	return div{
+		Class:    "epigraph",
+		Children: children,
+	}
+}
+
+// The scene break is centered by the style sheet, so it only needs
+// another class to line it up anywhere else.
+func (r *Renderer) renderSceneBreak() p {
+	class := "scene_break"
+	if r.sceneBreak.Alignment != parser.CenterAlignment {
+		class += " " + r.sceneBreak.Alignment.String()
+	}
+
+	// A blank scene break still needs some content, or the paragraph
+	// won't take up any room.
+	text := r.sceneBreak.Glyph
+	if r.sceneBreak.Blank() {
+		text = "\u00a0"
+	}
+	return p{Class: class, Text: text}
+}
+
+func (r *Renderer) renderScene(scene parser.Scene) div {
+	children := []interface{}{}
+	for _, s := range scene.Sections {
+		children = append(children, r.renderSection(s)...)
+	}
+
+	return div{
+		Class:    "scene",
+		Children: children,
+	}
+}
+
+func (r *Renderer) renderSection(section parser.Section) []interface{} {
+	children := []interface{}{}
+	if section.Title != "" {
+		children = append(children, h3{Text: section.Title})
+	}
+
+	for _, p := range section.Paragraphs {
+		children = append(children, r.renderParagraph(p))
+	}
+	return children
+}
+
+func (r *Renderer) renderParagraph(paragraph parser.Paragraph) interface{} {
+	// Paragraphs meant for other renderers are left out, and since nil
+	// encodes to nothing, they leave no trace in the output.
+	if !paragraph.RenderedBy("epub") {
+		return nil
+	}
+	if verse, ok := paragraph.Verse(); ok {
+		return r.renderVerse(verse)
+	}
+	if raw, ok := paragraph.Raw(); ok {
+		return rawDiv{Class: "raw", Content: raw.Content}
+	}
+	if block, ok := paragraph.Conditional(); ok {
+		children := []interface{}{}
+		for _, p := range block.Paragraphs {
+			children = append(children, r.renderParagraph(p))
+		}
+		return children
+	}
+	// EPUB readers can't be relied on to support <details>, so spoilers
+	// are shown as they are.
+	if spoiler, ok := paragraph.Spoiler(); ok {
+		children := []interface{}{}
+		for _, p := range spoiler.Paragraphs {
+			children = append(children, r.renderParagraph(p))
+		}
+		return children
+	}
+	if image, ok := paragraph.Image(); ok {
+		return r.renderImage(image)
+	}
+
+	children := []interface{}{}
+	quotes := util.Typographer{Dialogue: r.dialogueStyle}
+	for _, e := range paragraph.Text {
+		if r.dialogueStyle != nil {
+			e = quotes.Element(e)
+		}
+		children = append(children, r.renderElement(e))
+	}
+
+	return p{Class: paragraph.Alignment.String(), Children: children}
+}
+
+func (r *Renderer) renderImage(image parser.Image) div {
+	children := []interface{}{
+		img{Src: r.images[image.Path], Alt: image.Caption},
+	}
+	if image.Caption != "" {
+		children = append(children, p{Class: "caption", Text: image.Caption})
+	}
+	return div{Class: "illustration", Children: children}
+}
+
+func (r *Renderer) renderVerse(verse parser.VerseBlock) p {
+	children := []interface{}{}
+	quotes := util.Typographer{Dialogue: r.dialogueStyle}
+	for i, line := range verse.Lines {
+		if i != 0 {
+			children = append(children, br{})
+		}
+		for _, e := range line {
+			if r.dialogueStyle != nil {
+				e = quotes.Element(e)
+			}
+			children = append(children, r.renderElement(e))
+		}
+		quotes.LineBreak()
+	}
+
+	return p{Class: "verse", Children: children}
+}
+
+func (r *Renderer) renderElement(element parser.DocumentElement) interface{} {
+	switch e := element.(type) {
+	case parser.PlainText:
+		return span{Text: string(e)}
+	case parser.ItalicText:
+		return em{Text: string(e)}
+	case parser.BoldText:
+		return strong{Text: string(e)}
+	case parser.BoldItalicText:
+		return strong{Child: em{Text: string(e)}}
+	case parser.Footnote:
+		return span{Class: "footnote", Text: " (" + string(e) + ")"}
+	case parser.UnderlineText:
+		return span{Class: "underline", Text: string(e)}
+	case parser.StrikethroughText:
+		return del{Child: r.renderElement(e.Text)}
+	case parser.ColoredText:
+		return r.renderElement(e.Text)
+	default:
+		panic(
+			errors.New(
+				"epub: Unexpected document element passed to renderElement",
+			),
+		)
+	}
+}
+
+func (r *Renderer) writePackage() error {
+	document := r.document
+
+	creators := []opfCreator{}
+	for _, a := range document.Authors() {
+		if a.Byline != "" {
+			creators = append(creators, opfCreator{Role: "aut", Name: a.Byline})
+		}
+	}
+
+	manifest := []opfItem{
+		{ID: "ncx", HREF: "toc.ncx", MediaType: "application/x-dtbncx+xml"},
+		{ID: "style", HREF: "style.css", MediaType: "text/css"},
+	}
+	manifest = append(manifest, r.imageItems...)
+
+	spine := []opfItemRef{}
+	for _, pg := range r.pages {
+		manifest = append(
+			manifest,
+			opfItem{
+				ID:        pg.id,
+				HREF:      pg.fileName,
+				MediaType: "application/xhtml+xml",
+			},
+		)
+		spine = append(spine, opfItemRef{IDRef: pg.id})
+	}
+
+	return r.writeXML(
+		"OEBPS/content.opf",
+		"",
+		opfPackage{
+			Xmlns:            "http://www.idpf.org/2007/opf",
+			Version:          "2.0",
+			UniqueIdentifier: "book_id",
+			Metadata: opfMetadata{
+				DC:       "http://purl.org/dc/elements/1.1/",
+				OPF:      "http://www.idpf.org/2007/opf",
+				Title:    document.Title,
+				Creators: creators,
+				Subjects: document.Tags,
+				Language: document.Lang(),
+				Identifier: opfIdentifier{
+					ID:    "book_id",
+					Value: r.identifier(),
+				},
+			},
+			Manifest: manifest,
+			Spine: opfSpine{
+				TOC:      "ncx",
+				ItemRefs: spine,
+			},
+		},
+	)
+}
+
+func (r *Renderer) writeNCX() error {
+	depth := 1
+	playOrder := 0
+
+	// Play order has to follow reading order, which a depth-first
+	// walk of the navigation tree gives us.
+	var number func(points []navPoint, level int)
+	number = func(points []navPoint, level int) {
+		if len(points) != 0 && level > depth {
+			depth = level
+		}
+		for i := range points {
+			playOrder++
+			points[i].PlayOrder = playOrder
+			number(points[i].Children, level+1)
+		}
+	}
+	number(r.nav, 1)
+
+	return r.writeXML(
+		"OEBPS/toc.ncx",
+		"",
+		ncx{
+			Xmlns:   "http://www.daisy.org/z3986/2005/ncx/",
+			Version: "2005-1",
+			Head: []ncxMeta{
+				{Name: "dtb:uid", Content: r.identifier()},
+				{Name: "dtb:depth", Content: fmt.Sprint(depth)},
+				{Name: "dtb:totalPageCount", Content: "0"},
+				{Name: "dtb:maxPageNumber", Content: "0"},
+			},
+			DocTitle: r.document.Title,
+			NavMap:   r.nav,
+		},
+	)
+}
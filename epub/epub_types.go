@@ -0,0 +1,204 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package epub
+
+import (
+	"encoding/xml"
+)
+
+type container struct {
+	XMLName   xml.Name   `xml:"container"`
+	Xmlns     string     `xml:"xmlns,attr"`
+	Version   string     `xml:"version,attr"`
+	RootFiles []rootFile `xml:"rootfiles>rootfile"`
+}
+
+type rootFile struct {
+	FullPath  string `xml:"full-path,attr"`
+	MediaType string `xml:"media-type,attr"`
+}
+
+type opfPackage struct {
+	XMLName          xml.Name `xml:"package"`
+	Xmlns            string   `xml:"xmlns,attr"`
+	Version          string   `xml:"version,attr"`
+	UniqueIdentifier string   `xml:"unique-identifier,attr"`
+	Metadata         opfMetadata
+	Manifest         []opfItem `xml:"manifest>item"`
+	Spine            opfSpine
+}
+
+type opfMetadata struct {
+	XMLName    xml.Name `xml:"metadata"`
+	DC         string   `xml:"xmlns:dc,attr"`
+	OPF        string   `xml:"xmlns:opf,attr"`
+	Title      string   `xml:"dc:title"`
+	Creators   []opfCreator
+	Subjects   []string `xml:"dc:subject"`
+	Language   string   `xml:"dc:language"`
+	Identifier opfIdentifier
+}
+
+type opfCreator struct {
+	XMLName xml.Name `xml:"dc:creator"`
+	Role    string   `xml:"opf:role,attr"`
+	Name    string   `xml:",chardata"`
+}
+
+type opfIdentifier struct {
+	XMLName xml.Name `xml:"dc:identifier"`
+	ID      string   `xml:"id,attr"`
+	Value   string   `xml:",chardata"`
+}
+
+type opfItem struct {
+	ID        string `xml:"id,attr"`
+	HREF      string `xml:"href,attr"`
+	MediaType string `xml:"media-type,attr"`
+}
+
+type opfSpine struct {
+	XMLName  xml.Name     `xml:"spine"`
+	TOC      string       `xml:"toc,attr"`
+	ItemRefs []opfItemRef `xml:"itemref"`
+}
+
+type opfItemRef struct {
+	IDRef string `xml:"idref,attr"`
+}
+
+type ncx struct {
+	XMLName  xml.Name   `xml:"ncx"`
+	Xmlns    string     `xml:"xmlns,attr"`
+	Version  string     `xml:"version,attr"`
+	Head     []ncxMeta  `xml:"head>meta"`
+	DocTitle string     `xml:"docTitle>text"`
+	NavMap   []navPoint `xml:"navMap>navPoint"`
+}
+
+type ncxMeta struct {
+	Name    string `xml:"name,attr"`
+	Content string `xml:"content,attr"`
+}
+
+type navPoint struct {
+	ID        string `xml:"id,attr"`
+	PlayOrder int    `xml:"playOrder,attr"`
+	Label     string `xml:"navLabel>text"`
+	Content   navContent
+	Children  []navPoint `xml:"navPoint"`
+}
+
+type navContent struct {
+	XMLName xml.Name `xml:"content"`
+	Src     string   `xml:"src,attr"`
+}
+
+type xhtml struct {
+	XMLName xml.Name `xml:"html"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Dir     string   `xml:"dir,attr,omitempty"`
+	Head    header
+	Body    body
+}
+
+type header struct {
+	XMLName    xml.Name `xml:"head"`
+	Title      string   `xml:"title"`
+	StyleSheet link
+}
+
+type body struct {
+	XMLName  xml.Name `xml:"body"`
+	Children []interface{}
+}
+
+type link struct {
+	XMLName xml.Name `xml:"link"`
+	Rel     string   `xml:"rel,attr"`
+	Type    string   `xml:"type,attr"`
+	HREF    string   `xml:"href,attr"`
+}
+
+type div struct {
+	XMLName  xml.Name `xml:"div"`
+	Class    string   `xml:"class,attr"`
+	Children []interface{}
+}
+
+type h1 struct {
+	XMLName xml.Name `xml:"h1"`
+	Text    string   `xml:",chardata"`
+}
+
+type h2 struct {
+	XMLName xml.Name `xml:"h2"`
+	Text    string   `xml:",chardata"`
+}
+
+type h3 struct {
+	XMLName xml.Name `xml:"h3"`
+	Text    string   `xml:",chardata"`
+}
+
+type p struct {
+	XMLName  xml.Name      `xml:"p"`
+	Class    string        `xml:"class,attr,omitempty"`
+	Text     string        `xml:",chardata"`
+	Children []interface{} `xml:",omitempty"`
+}
+
+type span struct {
+	XMLName xml.Name `xml:"span"`
+	Class   string   `xml:"class,attr,omitempty"`
+	Text    string   `xml:",chardata"`
+}
+
+type em struct {
+	XMLName xml.Name `xml:"em"`
+	Text    string   `xml:",chardata"`
+}
+
+type strong struct {
+	XMLName xml.Name    `xml:"strong"`
+	Text    string      `xml:",chardata"`
+	Child   interface{} `xml:",omitempty"`
+}
+
+type del struct {
+	XMLName xml.Name `xml:"del"`
+	Child   interface{}
+}
+
+type br struct {
+	XMLName xml.Name `xml:"br"`
+}
+
+type img struct {
+	XMLName xml.Name `xml:"img"`
+	Src     string   `xml:"src,attr"`
+	Alt     string   `xml:"alt,attr"`
+}
+
+// rawDiv writes its content out exactly as given, without escaping.
+type rawDiv struct {
+	XMLName xml.Name `xml:"div"`
+	Class   string   `xml:"class,attr"`
+	Content string   `xml:",innerxml"`
+}
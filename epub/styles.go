@@ -0,0 +1,134 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package epub
+
+const styleSheet = `
+h1 {
+	text-align: center;
+	margin-top: 30%;
+}
+
+h2 {
+	text-align: center;
+	margin-bottom: 2em;
+}
+
+h3 {
+	text-align: center;
+}
+
+p {
+	margin: 0;
+	text-indent: 1.5em;
+}
+
+p.byline {
+	text-align: center;
+	text-indent: 0;
+}
+
+div.dedication {
+	font-style: italic;
+	text-align: center;
+	margin-top: 33%;
+}
+
+div.dedication p {
+	text-indent: 0;
+}
+
+div.epigraph {
+	font-style: italic;
+	text-align: right;
+	margin-bottom: 2em;
+}
+
+div.epigraph p {
+	text-indent: 0;
+}
+
+div.epigraph p.attribution {
+	font-style: normal;
+}
+
+p.scene_break {
+	text-align: center;
+	text-indent: 0;
+	margin: 1em 0;
+}
+
+p.scene_label {
+	text-align: center;
+	text-indent: 0;
+	font-style: italic;
+	margin-bottom: 1em;
+}
+
+p.verse {
+	text-indent: 0;
+	margin-left: 1.5em;
+}
+
+div.illustration {
+	text-align: center;
+	margin: 1em 0;
+}
+
+div.illustration img {
+	max-width: 100%;
+}
+
+p.caption {
+	text-indent: 0;
+	font-style: italic;
+}
+
+p.left, p.center, p.right {
+	text-indent: 0;
+}
+
+p.center {
+	text-align: center;
+}
+
+p.right {
+	text-align: right;
+}
+
+p.scene_break.left {
+	text-align: left;
+}
+
+span.underline {
+	text-decoration: underline;
+}
+`
+
+// rtlStyleSheet is added to styleSheet for stories that run from right
+// to left, to flip the rules that name a side.
+const rtlStyleSheet = `
+div.epigraph {
+	text-align: left;
+}
+
+p.verse {
+	margin-left: 0;
+	margin-right: 1.5em;
+}
+`
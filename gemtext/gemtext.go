@@ -0,0 +1,353 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gemtext
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/bieber/manuscript/parser"
+	"github.com/bieber/manuscript/renderers"
+	"github.com/bieber/manuscript/util"
+	"io"
+	"strings"
+)
+
+// Renderer provides a Render method to render the given document to
+// gemtext, the markup used by the Gemini protocol.
+type Renderer struct {
+	markSpans  bool
+	labels     util.Labels
+	sceneBreak renderers.SceneSeparator
+	document   parser.Document
+	buffer     bytes.Buffer
+}
+
+// Options lists the options accepted by New.
+var Options = append(
+	[]renderers.OptionSpec{
+		{
+			Name:        "markSpans",
+			Default:     "false",
+			Description: "Mark italic and bold text with * and **",
+		},
+	},
+	append(
+		renderers.NewSceneSeparator("* * *").Options(),
+		util.LabelOptions...,
+	)...,
+)
+
+func init() {
+	renderers.Register("gemtext", New, Options...)
+}
+
+// New constructs a new Renderer for the given document and
+// command-line arguments.
+func New(
+	document parser.Document,
+	options map[string]string,
+) (renderers.Renderer, error) {
+	renderer := Renderer{
+		labels:     util.DefaultLabels,
+		sceneBreak: renderers.NewSceneSeparator("* * *"),
+		document:   document,
+	}
+
+	for k, v := range options {
+		switch k {
+		case "markSpans":
+			renderer.markSpans = util.ArgIsTrue(v)
+		case "sceneBreak", "sceneBreakAlignment":
+			if err := renderer.sceneBreak.Set(k, v); err != nil {
+				return nil, err
+			}
+		case "partLabel", "chapterLabel", "prologueLabel",
+			"numberStyle", "partNumberStyle", "labelSeparator":
+			if err := renderer.labels.Set(k, v); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("Invalid gemtext option %s", k)
+		}
+	}
+
+	return &renderer, nil
+}
+
+// Render writes the requested document out to the specified io.Writer
+// as gemtext.
+func (r *Renderer) Render(fout io.Writer) error {
+	for _, p := range r.document.Parts {
+		err := r.renderPart(p)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(r.document.AfterMatter) != 0 {
+		err := r.renderAfterword()
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := r.buffer.WriteTo(fout)
+	return err
+}
+
+func (r *Renderer) renderAfterword() error {
+	_, err := r.buffer.WriteString("## Afterword\n\n")
+	if err != nil {
+		return err
+	}
+
+	for _, p := range r.document.AfterMatter {
+		err := r.renderParagraph(p)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Renderer) renderPart(part parser.Part) error {
+	if !part.Anonymous {
+		text := r.labels.PartLabel(part.Number, part.Title)
+		_, err := r.buffer.WriteString("# " + line(text) + "\n\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, c := range part.Chapters {
+		err := r.renderChapter(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Renderer) renderChapter(chapter parser.Chapter) error {
+	if !chapter.Anonymous {
+		text := r.labels.ChapterLabel(chapter.Number, chapter.Title)
+		if chapter.Prologue {
+			text = r.labels.PrologueLabel(chapter.Title)
+		}
+
+		_, err := r.buffer.WriteString("## " + line(text) + "\n\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	if chapter.Epigraph != nil {
+		err := r.renderEpigraph(*chapter.Epigraph)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, s := range chapter.Scenes {
+		err := r.renderScene(s)
+		if err != nil {
+			return err
+		}
+
+		if i != len(chapter.Scenes)-1 {
+			err := r.renderSceneBreak(s.BreakLabel)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *Renderer) renderEpigraph(epigraph parser.Epigraph) error {
+	text := "> " + line(epigraph.Text) + "\n"
+	if epigraph.Attribution != "" {
+		text += "> — " + line(epigraph.Attribution) + "\n"
+	}
+
+	_, err := r.buffer.WriteString(text + "\n")
+	return err
+}
+
+// Gemtext has no way to align text, so the scene break's alignment is
+// ignored, and a blank scene break is just an extra empty line.
+func (r *Renderer) renderSceneBreak(label string) error {
+	text := ""
+	if !r.sceneBreak.Blank() {
+		text = r.sceneBreak.Glyph + "\n"
+	}
+	text += "\n"
+
+	if label != "" {
+		text += line(label) + "\n\n"
+	}
+
+	_, err := r.buffer.WriteString(text)
+	return err
+}
+
+func (r *Renderer) renderScene(scene parser.Scene) error {
+	for _, s := range scene.Sections {
+		err := r.renderSection(s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Renderer) renderSection(section parser.Section) error {
+	if section.Title != "" {
+		_, err := r.buffer.WriteString("### " + line(section.Title) + "\n\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, p := range section.Paragraphs {
+		err := r.renderParagraph(p)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Gemini clients wrap long lines themselves, so each paragraph is
+// written out as a single line.
+func (r *Renderer) renderParagraph(paragraph parser.Paragraph) error {
+	if !paragraph.RenderedBy("gemtext") {
+		return nil
+	}
+	if verse, ok := paragraph.Verse(); ok {
+		return r.renderVerse(verse)
+	}
+	if raw, ok := paragraph.Raw(); ok {
+		_, err := r.buffer.WriteString(raw.Content + "\n\n")
+		return err
+	}
+	if block, ok := paragraph.Conditional(); ok {
+		for _, p := range block.Paragraphs {
+			if err := r.renderParagraph(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// There's no way to hide text here, so spoilers are shown as they
+	// are.
+	if spoiler, ok := paragraph.Spoiler(); ok {
+		for _, p := range spoiler.Paragraphs {
+			if err := r.renderParagraph(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if image, ok := paragraph.Image(); ok {
+		text := "=> " + image.Path
+		if image.Caption != "" {
+			text += " " + line(image.Caption)
+		}
+		_, err := r.buffer.WriteString(text + "\n\n")
+		return err
+	}
+
+	text := ""
+	for _, e := range paragraph.Text {
+		text += r.renderElement(e)
+	}
+
+	_, err := r.buffer.WriteString(line(text) + "\n\n")
+	return err
+}
+
+// Each line of verse is kept on a line of its own.
+func (r *Renderer) renderVerse(verse parser.VerseBlock) error {
+	lines := []string{}
+	for _, l := range verse.Lines {
+		text := ""
+		for _, e := range l {
+			text += r.renderElement(e)
+		}
+		lines = append(lines, line(text))
+	}
+
+	_, err := r.buffer.WriteString(strings.Join(lines, "\n") + "\n\n")
+	return err
+}
+
+func (r *Renderer) renderElement(element parser.DocumentElement) string {
+	italic, bold := "", ""
+	if r.markSpans {
+		italic, bold = "*", "**"
+	}
+
+	switch e := element.(type) {
+	case parser.PlainText:
+		return string(e)
+	case parser.ItalicText:
+		return italic + string(e) + italic
+	case parser.BoldText:
+		return bold + string(e) + bold
+	case parser.BoldItalicText:
+		return bold + italic + string(e) + italic + bold
+	case parser.Footnote:
+		return " (" + string(e) + ")"
+	case parser.UnderlineText:
+		return italic + string(e) + italic
+	case parser.StrikethroughText:
+		return r.renderElement(e.Text)
+	case parser.ColoredText:
+		return r.renderElement(e.Text)
+	default:
+		panic(
+			errors.New(
+				"gemtext: Unexpected document element passed to renderElement",
+			),
+		)
+	}
+}
+
+// linePrefixes are the markers that give a gemtext line a special
+// meaning when they start it.
+var linePrefixes = []string{"#", "*", ">", "=>", "```"}
+
+// line collapses text onto a single line of gemtext.  A line of text
+// that happens to start with one of the markers for a heading, list
+// item, quote, link or preformatted block would be read as one, so
+// it's written with a zero-width space in front.
+func line(text string) string {
+	text = strings.Replace(text, string(parser.SoftHyphen), "", -1)
+	text = strings.Join(util.Words(text), " ")
+	for _, prefix := range linePrefixes {
+		if strings.HasPrefix(text, prefix) {
+			return "\u200b" + text
+		}
+	}
+	return text
+}
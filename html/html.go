@@ -19,24 +19,212 @@
 package html
 
 import (
+	"bytes"
 	"encoding/xml"
 	"errors"
 	"fmt"
-	"github.com/StefanSchroeder/Golang-Roman"
 	"github.com/bieber/manuscript/parser"
 	"github.com/bieber/manuscript/renderers"
+	"github.com/bieber/manuscript/util"
 	"github.com/dustin/go-humanize"
+	"html/template"
 	"io"
+	"os"
+	"strconv"
 	"strings"
 )
 
+var tocStyles = map[string]bool{
+	"numbered": true,
+	"bulleted": true,
+	"plain":    true,
+}
+
+var profiles = map[string]bool{
+	"web":    true,
+	"kindle": true,
+}
+
 // Renderer provides a Render method to render the given document to
 // an HTML file.
 type Renderer struct {
-	styleSheet string
-	authorInfo bool
-	includeTOC bool
-	document   parser.Document
+	styleSheet    string
+	profile       string
+	authorInfo    bool
+	titlePage     bool
+	includeTOC    bool
+	tocDepth      int
+	tocStyle      string
+	tocWords      bool
+	semantic      bool
+	typography    bool
+	dialogueStyle *util.QuoteStyle
+	classPrefix   string
+	slugAnchors   bool
+	anonymous     bool
+	bylinePrefix  string
+	novelPrefix   string
+	numberScenes  bool
+	indentFirst   bool
+	unindented    bool
+	endMarker     bool
+	endMarkerText string
+	dropCap       bool
+	meta          bool
+	opening       bool
+	template      *template.Template
+	labels        util.Labels
+	sceneBreak    renderers.SceneSeparator
+	anchors       map[string]string
+	chapterAnchor string
+	sectionCount  int
+	bodyStarted   bool
+	document      parser.Document
+	footnotes     []string
+}
+
+// Options lists the options accepted by New.
+var Options = append(
+	[]renderers.OptionSpec{
+		{
+			Name:        "styleSheet",
+			Default:     "",
+			Description: "Path to a style sheet to use instead of the default",
+		},
+		{
+			Name:        "profile",
+			Default:     "web",
+			Description: "Output profile: web, or kindle for Kindle-safe HTML",
+		},
+		{
+			Name:        "authorInfo",
+			Default:     "false",
+			Description: "Include the author's contact information",
+		},
+		{
+			Name:        "titlePage",
+			Default:     "true",
+			Description: "Start with the cover, title and byline",
+		},
+		{
+			Name:        "includeTOC",
+			Default:     "false",
+			Description: "Include a table of contents",
+		},
+		{
+			Name:        "tocDepth",
+			Default:     "2",
+			Description: "Contents depth: 1 for parts, 2 chapters, 3 sections",
+		},
+		{
+			Name:        "tocStyle",
+			Default:     "bulleted",
+			Description: "Contents list style: numbered, bulleted or plain",
+		},
+		{
+			Name:        "tocWordCounts",
+			Default:     "false",
+			Description: "Show chapter word counts in the contents",
+		},
+		{
+			Name:        "semantic",
+			Default:     "false",
+			Description: "Use <article> and <section> instead of <div>",
+		},
+		{
+			Name:        "typography",
+			Default:     "false",
+			Description: "Use curly quotes, typographic dashes and ellipses",
+		},
+		{
+			Name:        "dialogueStyle",
+			Default:     "",
+			Description: "Dialogue quotes: english, german, french or none",
+		},
+		{
+			Name:        "classPrefix",
+			Default:     "",
+			Description: "Prefix to add to every CSS class name",
+		},
+		{
+			Name:        "slugAnchors",
+			Default:     "false",
+			Description: "Name part and chapter anchors after their titles",
+		},
+		{
+			Name:        "anonymous",
+			Default:     "false",
+			Description: "Leave out the byline and author info",
+		},
+		{
+			Name:        "bylinePrefix",
+			Default:     "by",
+			Description: "Text before the author's name in the byline",
+		},
+		{
+			Name:        "novelPrefix",
+			Default:     "a novel",
+			Description: "Text before the byline of a novel",
+		},
+		{
+			Name:        "template",
+			Default:     "",
+			Description: "Path to an HTML template to use for the page layout",
+		},
+		{
+			Name:        "numberScenes",
+			Default:     "false",
+			Description: "Number each scene within its chapter, as in 1.2",
+		},
+		{
+			Name:        "firstLineIndent",
+			Default:     "true",
+			Description: "Indent the first paragraph after a heading or break",
+		},
+		{
+			Name:        "endMarker",
+			Default:     "auto",
+			Description: "Mark the end of the story, by default only if short",
+		},
+		{
+			Name:        "endMarkerText",
+			Default:     "# # #",
+			Description: "Text of the end marker",
+		},
+		{
+			Name:        "dropCap",
+			Default:     "false",
+			Description: "Set the first letter of each chapter as a drop cap",
+		},
+		{
+			Name:        "meta",
+			Default:     "false",
+			Description: "Add meta tags for link previews to the page's head",
+		},
+	},
+	append(
+		renderers.NewSceneSeparator("").Options(),
+		util.LabelOptions...,
+	)...,
+)
+
+// templateData holds the pieces of a rendered document that are
+// available to a custom template.  Everything but the title and class
+// is already rendered HTML, so the template won't escape it again.
+type templateData struct {
+	Title       string
+	Class       string
+	Lang        string
+	Dir         string
+	Style       template.HTML
+	Meta        template.HTML
+	FrontMatter template.HTML
+	TOC         template.HTML
+	Body        template.HTML
+}
+
+func init() {
+	renderers.Register("html", New, Options...)
 }
 
 // New constructs a new Renderer for the given document and
@@ -46,22 +234,111 @@ func New(
 	options map[string]string,
 ) (renderers.Renderer, error) {
 	renderer := Renderer{
-		document: document,
+		profile:       "web",
+		titlePage:     true,
+		tocDepth:      2,
+		tocStyle:      "bulleted",
+		indentFirst:   true,
+		bylinePrefix:  "by",
+		novelPrefix:   "a novel",
+		endMarker:     document.Type == parser.ShortStory,
+		endMarkerText: "# # #",
+		labels:        util.DefaultLabels,
+		sceneBreak:    renderers.NewSceneSeparator(""),
+		document:      document,
 	}
 
 	for k, v := range options {
 		switch k {
 		case "styleSheet":
 			renderer.styleSheet = v
+		case "profile":
+			if !profiles[v] {
+				return nil, fmt.Errorf("Invalid HTML profile %s", v)
+			}
+			renderer.profile = v
 		case "authorInfo":
-			renderer.authorInfo = argIsTrue(v)
+			renderer.authorInfo = util.ArgIsTrue(v)
+		case "titlePage":
+			renderer.titlePage = util.ArgIsTrue(v)
 		case "includeTOC":
-			renderer.includeTOC = argIsTrue(v)
+			renderer.includeTOC = util.ArgIsTrue(v)
+		case "tocDepth":
+			depth, err := strconv.Atoi(v)
+			if err != nil || depth < 1 || depth > 3 {
+				return nil, fmt.Errorf("Invalid HTML TOC depth %s", v)
+			}
+			renderer.tocDepth = depth
+		case "tocStyle":
+			if !tocStyles[v] {
+				return nil, fmt.Errorf("Invalid HTML TOC style %s", v)
+			}
+			renderer.tocStyle = v
+		case "tocWordCounts":
+			renderer.tocWords = util.ArgIsTrue(v)
+		case "semantic":
+			renderer.semantic = util.ArgIsTrue(v)
+		case "typography":
+			renderer.typography = util.ArgIsTrue(v)
+		case "dialogueStyle":
+			style, err := util.ParseQuoteStyle(v)
+			if err != nil {
+				return nil, err
+			}
+			renderer.dialogueStyle = style
+		case "classPrefix":
+			renderer.classPrefix = v
+		case "slugAnchors":
+			renderer.slugAnchors = util.ArgIsTrue(v)
+		case "anonymous":
+			renderer.anonymous = util.ArgIsTrue(v)
+		case "bylinePrefix":
+			renderer.bylinePrefix = v
+		case "novelPrefix":
+			renderer.novelPrefix = v
+		case "template":
+			t, err := template.ParseFiles(v)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid HTML template %s", v)
+			}
+			renderer.template = t
+		case "numberScenes":
+			renderer.numberScenes = util.ArgIsTrue(v)
+		case "firstLineIndent":
+			renderer.indentFirst = util.ArgIsTrue(v)
+		case "endMarker":
+			if v != "auto" {
+				renderer.endMarker = util.ArgIsTrue(v)
+			}
+		case "endMarkerText":
+			renderer.endMarkerText = v
+		case "dropCap":
+			renderer.dropCap = util.ArgIsTrue(v)
+		case "meta":
+			renderer.meta = util.ArgIsTrue(v)
+		case "sceneBreak", "sceneBreakAlignment":
+			if err := renderer.sceneBreak.Set(k, v); err != nil {
+				return nil, err
+			}
+		case "partLabel", "chapterLabel", "prologueLabel",
+			"numberStyle", "partNumberStyle", "labelSeparator":
+			if err := renderer.labels.Set(k, v); err != nil {
+				return nil, err
+			}
 		default:
 			return nil, fmt.Errorf("Invalid HTML option %s", k)
 		}
 	}
 
+	if renderer.anonymous {
+		renderer.authorInfo = false
+	}
+
+	// A preview card without a summary isn't much of a preview.
+	if renderer.meta && document.Description == "" {
+		return nil, errors.New("Missing @description for meta option")
+	}
+
 	return &renderer, nil
 }
 
@@ -69,19 +346,75 @@ func New(
 // as an HTML file.
 func (r *Renderer) Render(fout io.Writer) error {
 	encoder := xml.NewEncoder(selfClosingRemover{fout})
+	r.footnotes = []string{}
+	r.anchors = r.buildAnchors()
+
+	for _, image := range r.document.Images() {
+		if _, err := os.Stat(image.Path); err != nil {
+			return fmt.Errorf("Invalid image %s", image.Path)
+		}
+	}
 
-	bodyContents := []interface{}{}
-	bodyContents = append(bodyContents, r.renderFrontMatter())
+	// Without a title page, the story starts right in on the body, as
+	// when it's one of several embedded in a larger page.
+	frontMatter := []interface{}{}
+	if r.document.CoverImage != "" && r.titlePage {
+		if _, err := os.Stat(r.document.CoverImage); err != nil {
+			return fmt.Errorf("Invalid cover image %s", r.document.CoverImage)
+		}
+		frontMatter = append(
+			frontMatter,
+			img{
+				Class: r.class("cover"),
+				Src:   r.document.CoverImage,
+				Alt:   "Cover",
+			},
+		)
+	}
+	if r.titlePage {
+		frontMatter = append(frontMatter, r.renderFrontMatter())
+	}
+	if len(r.document.Dedication) != 0 {
+		frontMatter = append(frontMatter, r.renderDedication())
+	}
 
+	toc := []interface{}{}
 	if r.includeTOC {
-		toc := r.renderTOC()
-		if len(toc.Children) != 0 {
-			bodyContents = append(bodyContents, toc)
+		if t := r.renderTOC(); len(t.Children) != 0 {
+			toc = append(toc, t)
 		}
 	}
 
+	// Kindle starts each part and chapter on a new page, except for
+	// whatever comes first in the book.
+	r.bodyStarted = len(frontMatter) != 0 || len(toc) != 0
+
+	parts := []interface{}{}
 	for _, p := range r.document.Parts {
-		bodyContents = append(bodyContents, r.renderPart(p))
+		parts = append(parts, r.renderPart(p))
+	}
+
+	if r.endMarker {
+		parts = append(
+			parts,
+			p{Class: r.class("end_marker"), Text: r.endMarkerText},
+		)
+	}
+
+	// The afterword comes before the footnotes, since it may have
+	// footnotes of its own.
+	if len(r.document.AfterMatter) != 0 {
+		parts = append(parts, r.renderAfterword())
+	}
+
+	if len(r.footnotes) != 0 {
+		parts = append(parts, r.renderFootnotes())
+	}
+
+	if r.profile == "kindle" && r.styleSheet == "" {
+		frontMatter = r.styleForKindle(frontMatter, nil)
+		toc = r.styleForKindle(toc, nil)
+		parts = r.styleForKindle(parts, nil)
 	}
 
 	storyTypeClass := ""
@@ -91,26 +424,108 @@ func (r *Renderer) Render(fout io.Writer) error {
 		storyTypeClass = " short_story"
 	}
 
+	if r.template != nil {
+		return r.renderTemplate(
+			fout,
+			r.class("container"+storyTypeClass),
+			frontMatter,
+			toc,
+			parts,
+		)
+	}
+
+	bodyContents := append(append(frontMatter, toc...), parts...)
+
 	encoder.Indent("", "\t")
 	return encoder.Encode(
 		document{
+			Lang: r.document.Lang(),
+			Dir:  r.document.Direction,
 			Head: r.renderHead(),
 			Body: body{
-				Content: div{
-					Class:    "container" + storyTypeClass,
-					Children: bodyContents,
-				},
+				Content: r.article(
+					"container"+storyTypeClass,
+					bodyContents,
+				),
 			},
 		},
 	)
 }
 
+// renderTemplate renders each piece of the document to HTML on its
+// own and fills them in to the user's template.
+func (r *Renderer) renderTemplate(
+	fout io.Writer,
+	class string,
+	frontMatter, toc, parts []interface{},
+) error {
+	head := r.renderHead()
+
+	data := templateData{
+		Title: r.document.Title,
+		Class: class,
+		Lang:  r.document.Lang(),
+		Dir:   r.document.Direction,
+	}
+	pieces := []struct {
+		dest     *template.HTML
+		elements []interface{}
+	}{
+		{&data.Style, []interface{}{head.StyleSheet, head.Style}},
+		{&data.Meta, []interface{}{head.Meta}},
+		{&data.FrontMatter, frontMatter},
+		{&data.TOC, toc},
+		{&data.Body, parts},
+	}
+
+	for _, piece := range pieces {
+		buffer := bytes.Buffer{}
+		encoder := xml.NewEncoder(selfClosingRemover{&buffer})
+		encoder.Indent("", "\t")
+		for _, e := range piece.elements {
+			if err := encoder.Encode(e); err != nil {
+				return err
+			}
+		}
+		*piece.dest = template.HTML(buffer.String())
+	}
+
+	return r.template.Execute(fout, data)
+}
+
 func (r *Renderer) renderHead() header {
 	var styleSheet *link
 	var inlineStyleSheet *style
-	if r.styleSheet == "" {
-		rawStyle := inlineStyle
 
+	// The kindle profile writes its styles on each element instead.
+	rawStyle := ""
+	if r.styleSheet == "" && r.profile != "kindle" {
+		rawStyle = inlineStyle
+		if r.document.RightToLeft() {
+			rawStyle += rtlStyle
+		}
+		rawStyle += tocListStyles[r.tocStyle]
+		if r.classPrefix != "" {
+			rawStyle = classSelector.ReplaceAllString(
+				rawStyle,
+				"."+r.classPrefix+"$1",
+			)
+		}
+	} else if r.styleSheet != "" {
+		styleSheet = &link{
+			Rel:  "stylesheet",
+			Type: "text/css",
+			HREF: r.styleSheet,
+		}
+	}
+
+	// Any styles from the story itself come after the default or
+	// external style sheet, so that they take precedence.
+	if r.document.HTMLStyle != "" {
+		rawStyle += "\n" + r.document.HTMLStyle + "\n"
+	}
+
+	if rawStyle != "" {
 		styleLines := strings.Split(rawStyle, "\n")
 		for i := range styleLines {
 			if i != len(styleLines)-1 {
@@ -119,187 +534,279 @@ func (r *Renderer) renderHead() header {
 		}
 
 		inlineStyleSheet = &style{Text: strings.Join(styleLines, "\n") + "\t\t"}
-	} else if r.styleSheet != "" {
-		styleSheet = &link{
-			Rel:  "stylesheet",
-			Type: "text/css",
-			HREF: r.styleSheet,
-		}
 	}
 
 	return header{
 		Title:      r.document.Title,
+		Meta:       r.renderMeta(),
 		StyleSheet: styleSheet,
 		Style:      inlineStyleSheet,
 	}
 }
 
-func (r *Renderer) renderFrontMatter() div {
-	document := r.document
+// renderMeta lists the tags describing the story to search engines and
+// to sites building a preview of a link to it.
+func (r *Renderer) renderMeta() []meta {
+	if !r.meta {
+		return nil
+	}
 
-	contents := []interface{}{}
+	tags := []meta{
+		{Property: "og:title", Content: r.document.Title},
+		{Name: "description", Content: r.document.Description},
+		{Property: "og:description", Content: r.document.Description},
+	}
+	if len(r.document.Tags) != 0 {
+		keywords := strings.Join(r.document.Tags, ", ")
+		tags = append(tags, meta{Name: "keywords", Content: keywords})
+	}
+	if byline := r.document.Byline(); byline != "" && !r.anonymous {
+		tags = append(tags, meta{Name: "author", Content: byline})
+	}
+	return tags
+}
 
-	if r.authorInfo {
-		authorContents := []interface{}{}
-		if document.Author.Name != "" {
-			authorContents = append(
-				authorContents,
-				span{Text: document.Author.Name},
-				br{},
-			)
-		}
-		if len(document.Author.Address) != 0 {
-			for _, l := range document.Author.Address {
-				authorContents = append(
-					authorContents,
-					span{Text: l},
-					br{},
-				)
-			}
-		}
-		if document.Author.PhoneNumber != "" {
+func (r *Renderer) renderDedication() div {
+	children := []interface{}{}
+	for _, line := range r.document.Dedication {
+		children = append(children, p{Text: line})
+	}
+
+	return div{Class: r.class("dedication"), Children: children}
+}
+
+func (r *Renderer) renderAuthorInfo(author parser.Author) div {
+	authorContents := []interface{}{}
+	if author.Name != "" {
+		authorContents = append(
+			authorContents,
+			span{Text: author.Name},
+			br{},
+		)
+	}
+	if len(author.Address) != 0 {
+		for _, l := range author.Address {
 			authorContents = append(
 				authorContents,
-				span{Text: document.Author.PhoneNumber},
+				span{Text: l},
 				br{},
 			)
 		}
-		if document.Author.EmailAddress != "" {
+	}
+	if author.PhoneNumber != "" {
+		authorContents = append(
+			authorContents,
+			span{Text: author.PhoneNumber},
+			br{},
+		)
+	}
+	if author.EmailAddress != "" {
+		authorContents = append(
+			authorContents,
+			span{Text: author.EmailAddress},
+			br{},
+		)
+	}
+	if author.Website != "" {
+		authorContents = append(
+			authorContents,
+			a{HREF: author.Website, Text: author.Website},
+			br{},
+		)
+	}
+	for _, l := range author.SocialLinks {
+		authorContents = append(
+			authorContents,
+			a{HREF: l, Text: l},
+			br{},
+		)
+	}
+	if len(author.ProfessionalOrgs) != 0 {
+		for _, l := range author.ProfessionalOrgs {
 			authorContents = append(
 				authorContents,
-				span{Text: document.Author.EmailAddress},
+				span{Text: l},
 				br{},
 			)
 		}
-		if len(document.Author.ProfessionalOrgs) != 0 {
-			for _, l := range document.Author.ProfessionalOrgs {
-				authorContents = append(
-					authorContents,
-					span{Text: l},
-					br{},
-				)
+	}
+
+	return div{Class: r.class("author_info"), Children: authorContents}
+}
+
+func (r *Renderer) renderFrontMatter() div {
+	document := r.document
+
+	contents := []interface{}{}
+
+	if r.authorInfo {
+		// Each author, including any co-authors, gets their own
+		// block of contact information.
+		for i, author := range document.Authors() {
+			info := r.renderAuthorInfo(author)
+			if i == 0 || len(info.Children) != 0 {
+				contents = append(contents, info)
 			}
 		}
+	}
+
+	contents = append(contents, h1{Title: document.Title})
 
+	authorText := strings.TrimSpace(r.bylinePrefix + " " + document.Byline())
+	if r.anonymous {
+		authorText = ""
+	}
+	if r.document.Type == parser.Novel {
+		authorText = strings.TrimSpace(r.novelPrefix + " " + authorText)
+	}
+	if authorText != "" {
 		contents = append(
 			contents,
-			div{Class: "author_info", Children: authorContents},
+			p{Class: r.class("byline"), Text: authorText},
 		)
 	}
 
-	contents = append(contents, h1{Title: document.Title})
-
-	authorText := "by " + document.Author.Byline
-	if r.document.Type == parser.Novel {
-		authorText = "a novel " + authorText
+	if !document.Date.IsZero() {
+		dateText := document.Date.Format("January 2, 2006")
+		contents = append(
+			contents,
+			p{Class: r.class("date"), Text: dateText},
+		)
 	}
-	contents = append(contents, p{Class: "byline", Text: authorText})
 
 	wordText := "about " + humanize.Comma(document.WordCount()) + " words"
-	contents = append(contents, p{Class: "word_count", Text: wordText})
+	contents = append(
+		contents,
+		p{Class: r.class("word_count"), Text: wordText},
+	)
 
 	return div{
-		Class:    "front_matter",
+		Class:    r.class("front_matter"),
 		Children: contents,
 	}
 }
 
+// renderTOC lists the story's parts, chapters, and titled sections,
+// as deep as the tocDepth option allows.  Anything without a heading
+// of its own is left out, and its entries are moved up a level.
 func (r *Renderer) renderTOC() div {
 	outerChildren := []interface{}{}
 
 	for _, p := range r.document.Parts {
 		children := []interface{}{}
 		for _, c := range p.Chapters {
+			if r.tocDepth < 2 {
+				break
+			}
+
+			sections := []interface{}{}
+			if r.tocDepth >= 3 {
+				sections = r.renderTOCSections(p, c)
+			}
 			if c.Anonymous {
+				children = append(children, sections...)
 				continue
 			}
 
 			text, href := "", ""
 			if c.Prologue {
-				text = "Prologue"
-				if c.Title != "" {
-					text += ": " + c.Title
-				}
-				href = fmt.Sprintf("#prologue_%d_%d", p.Number, c.Number)
+				text = r.labels.PrologueLabel(c.Title)
+				href = "#" + r.anchor("prologue_%d_%d", p.Number, c.Number)
 			} else {
-				text = fmt.Sprintf("Chapter %d", c.Number)
-				if c.Title != "" {
-					text += ": " + c.Title
-				}
-				href = fmt.Sprintf("#chapter_%d_%d", p.Number, c.Number)
+				text = r.labels.ChapterLabel(c.Number, c.Title)
+				href = "#" + r.anchor("chapter_%d_%d", p.Number, c.Number)
 			}
 
-			children = append(
-				children,
-				li{
-					Children: []interface{}{
-						a{
-							Text: text,
-							HREF: href,
-						},
-					},
-				},
-			)
-		}
+			if r.tocWords {
+				text += " (about " + humanize.Comma(c.WordCount()) + " words)"
+			}
 
-		if len(children) == 0 {
-			continue
+			entry := []interface{}{a{Text: text, HREF: href}}
+			if len(sections) != 0 {
+				entry = append(entry, ol{Children: sections})
+			}
+			children = append(children, li{Children: entry})
 		}
 
 		if p.Anonymous {
 			outerChildren = append(outerChildren, children...)
-		} else {
-			text := "Part " + roman.Roman(p.Number)
-			if p.Title != "" {
-				text += ": " + p.Title
-			}
+			continue
+		}
 
-			outerChildren = append(
-				outerChildren,
-				li{
-					Children: []interface{}{
-						a{
-							Text: text,
-							HREF: fmt.Sprintf("#part_%d", p.Number),
-						},
-						ol{
-							Children: children,
-						},
-					},
-				},
-			)
+		text := r.labels.PartLabel(p.Number, p.Title)
+		entry := []interface{}{
+			a{Text: text, HREF: "#" + r.anchor("part_%d", p.Number)},
 		}
+		if len(children) != 0 {
+			entry = append(entry, ol{Children: children})
+		} else if r.tocDepth >= 2 {
+			// A part with nothing to list under it is left out, as it
+			// always has been, unless only parts are being listed.
+			continue
+		}
+		outerChildren = append(outerChildren, li{Children: entry})
 	}
 
 	if len(outerChildren) == 0 {
 		return div{}
 	}
 
+	// The list markup is the same in every style, with the markers
+	// left to the style sheet, so the other styles just add a class
+	// for it to go by.
+	class := "table_of_contents"
+	if r.tocStyle != "bulleted" {
+		class += " " + r.tocStyle
+	}
 	return div{
-		Class: "table_of_contents",
+		Class: r.class(class),
 		Children: []interface{}{
-			ol{Class: "toc_outer", Children: outerChildren},
+			ol{Class: r.class("toc_outer"), Children: outerChildren},
 		},
 	}
 }
 
-func (r *Renderer) renderPart(part parser.Part) div {
+// renderTOCSections lists a chapter's titled sections for the table
+// of contents.
+func (r *Renderer) renderTOCSections(
+	part parser.Part,
+	chapter parser.Chapter,
+) []interface{} {
+	entries := []interface{}{}
+	prefix := chapterAnchorName(part.Number, chapter)
+	n := 0
+	for _, s := range chapter.Scenes {
+		for _, sec := range s.Sections {
+			if sec.Title == "" {
+				continue
+			}
+			n++
+
+			href := "#" + r.anchor("%s_section_%d", prefix, n)
+			entries = append(
+				entries,
+				li{Children: []interface{}{a{Text: sec.Title, HREF: href}}},
+			)
+		}
+	}
+	return entries
+}
+
+func (r *Renderer) renderPart(part parser.Part) interface{} {
 	class := "anonymous_part"
 	children := []interface{}{}
 
 	if !part.Anonymous {
 		class = "part"
-		text := "Part " + roman.Roman(part.Number)
-		if part.Title != "" {
-			text += ": " + part.Title
-		}
+		text := r.labels.PartLabel(part.Number, part.Title)
 
+		children = append(children, r.pageBreak()...)
 		children = append(
 			children,
 			h2{
 				Children: []interface{}{
 					a{
-						Name: fmt.Sprintf("part_%d", part.Number),
+						Name: r.anchor("part_%d", part.Number),
 						Text: text,
 					},
 				},
@@ -311,32 +818,34 @@ func (r *Renderer) renderPart(part parser.Part) div {
 		children = append(children, r.renderChapter(c, part.Number))
 	}
 
-	return div{
-		Class:    class,
-		Children: children,
-	}
-
+	return r.section(class, children)
 }
 
-func (r *Renderer) renderChapter(chapter parser.Chapter, partNumber int) div {
+func (r *Renderer) renderChapter(
+	chapter parser.Chapter,
+	partNumber int,
+) interface{} {
 	class := "anonymous_chapter"
 	children := []interface{}{}
 
+	// Titled sections are numbered within their chapter for their
+	// anchors.
+	r.chapterAnchor = chapterAnchorName(partNumber, chapter)
+	r.sectionCount = 0
+
 	if !chapter.Anonymous {
+		children = append(children, r.pageBreak()...)
 		if chapter.Prologue {
 			class = "chapter prologue"
 
-			text := "Prologue"
-			if chapter.Title != "" {
-				text += ": " + chapter.Title
-			}
+			text := r.labels.PrologueLabel(chapter.Title)
 
 			children = append(
 				children,
 				h3{
 					Children: []interface{}{
 						a{
-							Name: fmt.Sprintf(
+							Name: r.anchor(
 								"prologue_%d_%d",
 								partNumber,
 								chapter.Number,
@@ -349,17 +858,14 @@ func (r *Renderer) renderChapter(chapter parser.Chapter, partNumber int) div {
 		} else {
 			class = "chapter"
 
-			text := fmt.Sprintf("Chapter %d", chapter.Number)
-			if chapter.Title != "" {
-				text += ": " + chapter.Title
-			}
+			text := r.labels.ChapterLabel(chapter.Number, chapter.Title)
 
 			children = append(
 				children,
 				h3{
 					Children: []interface{}{
 						a{
-							Name: fmt.Sprintf(
+							Name: r.anchor(
 								"chapter_%d_%d",
 								partNumber,
 								chapter.Number,
@@ -372,35 +878,254 @@ func (r *Renderer) renderChapter(chapter parser.Chapter, partNumber int) div {
 		}
 	}
 
-	for _, s := range chapter.Scenes {
-		children = append(children, r.renderScene(s))
+	if chapter.Epigraph != nil {
+		children = append(children, r.renderEpigraph(*chapter.Epigraph))
+	}
+
+	// The drop cap goes on the chapter's first paragraph of prose, even
+	// if it follows a verse block or an illustration.
+	r.opening = r.dropCap
+	defer func() { r.opening = false }()
+
+	for i, s := range chapter.Scenes {
+		if i != 0 && r.sceneBreak.Glyph != "" {
+			children = append(children, r.renderSceneBreak())
+		}
+		label := ""
+		if i != 0 {
+			label = chapter.Scenes[i-1].BreakLabel
+		}
+		number := ""
+		if r.numberScenes {
+			number = util.SceneNumber(chapter, i)
+		}
+		children = append(children, r.renderScene(s, label, number))
+	}
+	r.bodyStarted = true
+
+	return r.section(class, children)
+}
+
+// Without a sceneBreak option, scenes are only separated by the
+// border in the style sheet.
+func (r *Renderer) renderSceneBreak() p {
+	class := "scene_break"
+	if r.sceneBreak.Alignment != parser.CenterAlignment {
+		class += " " + r.sceneBreak.Alignment.String()
+	}
+
+	text := r.sceneBreak.Glyph
+	if r.sceneBreak.Blank() {
+		text = "\u00a0"
+	}
+	return p{Class: r.class(class), Text: text}
+}
+
+func (r *Renderer) renderAfterword() div {
+	children := append(
+		r.pageBreak(),
+		h3{Children: []interface{}{a{Name: "afterword", Text: "Afterword"}}},
+	)
+	r.unindented = !r.indentFirst
+	for _, p := range r.document.AfterMatter {
+		children = append(children, r.renderParagraph(p))
+	}
+
+	return div{Class: r.class("after_matter"), Children: children}
+}
+
+func (r *Renderer) renderEpigraph(epigraph parser.Epigraph) div {
+	children := []interface{}{p{Text: epigraph.Text}}
+	if epigraph.Attribution != "" {
+		children = append(
+			children,
+			p{
+				Class: r.class("attribution"),
+				Text:  "— " + epigraph.Attribution,
+			},
+		)
 	}
 
 	return div{
-		Class:    class,
+		Class:    r.class("epigraph"),
 		Children: children,
 	}
 }
 
-func (r *Renderer) renderScene(scene parser.Scene) div {
+// renderScene renders a single scene, headed by the label from the
+// break before it and by the given scene number unless they're empty.
+// The label goes inside the scene so the style sheet's rule between
+// adjacent scenes still applies.
+func (r *Renderer) renderScene(
+	scene parser.Scene,
+	label string,
+	number string,
+) interface{} {
 	children := []interface{}{}
-	for _, p := range scene.Paragraphs {
+	if label != "" {
+		children = append(
+			children,
+			p{Class: r.class("scene_label"), Text: label},
+		)
+	}
+	if number != "" {
+		children = append(
+			children,
+			h5{Class: r.class("scene_number"), Text: number},
+		)
+	}
+
+	// Unless firstLineIndent is on, the first paragraph of the scene and
+	// of each titled section in it is set flush left, as in print.
+	r.unindented = !r.indentFirst
+	for _, s := range scene.Sections {
+		children = append(children, r.renderSection(s)...)
+	}
+
+	return r.section("scene", children)
+}
+
+func (r *Renderer) renderSection(section parser.Section) []interface{} {
+	children := []interface{}{}
+	if section.Title != "" {
+		r.sectionCount++
+		name := r.anchor("%s_section_%d", r.chapterAnchor, r.sectionCount)
+		children = append(
+			children,
+			h4{Children: []interface{}{a{Name: name, Text: section.Title}}},
+		)
+		r.unindented = !r.indentFirst
+	}
+
+	for _, p := range section.Paragraphs {
 		children = append(children, r.renderParagraph(p))
 	}
+	return children
+}
 
-	return div{
-		Class:    "scene",
+// Spoilers are hidden in a <details> element until the reader opens
+// it, with the spoiler's title as the summary to click on.
+func (r *Renderer) renderSpoiler(spoiler parser.SpoilerBlock) interface{} {
+	title := spoiler.Title
+	if title == "" {
+		title = "Spoiler"
+	}
+
+	children := []interface{}{}
+	for _, p := range spoiler.Paragraphs {
+		children = append(children, r.renderParagraph(p))
+	}
+	return details{
+		Class:    r.class("spoiler"),
+		Summary:  summary{Text: title},
 		Children: children,
 	}
 }
 
-func (r *Renderer) renderParagraph(paragraph parser.Paragraph) p {
+func (r *Renderer) renderParagraph(paragraph parser.Paragraph) interface{} {
+	// Paragraphs meant for other renderers are left out, and since nil
+	// encodes to nothing, they leave no trace in the output.
+	if !paragraph.RenderedBy("html") {
+		return nil
+	}
+	if block, ok := paragraph.Conditional(); ok {
+		children := []interface{}{}
+		for _, p := range block.Paragraphs {
+			children = append(children, r.renderParagraph(p))
+		}
+		return children
+	}
+	if spoiler, ok := paragraph.Spoiler(); ok {
+		return r.renderSpoiler(spoiler)
+	}
+
+	unindented := r.unindented
+	r.unindented = false
+
+	if verse, ok := paragraph.Verse(); ok {
+		return r.renderVerse(verse)
+	}
+	if raw, ok := paragraph.Raw(); ok {
+		return rawDiv{Class: r.class("raw"), Content: raw.Content}
+	}
+	if image, ok := paragraph.Image(); ok {
+		return r.renderImage(image)
+	}
+
+	dropCap := r.opening
+	r.opening = false
+
+	elements := paragraph.Text
+	if quotes := r.typographer(); quotes != nil {
+		elements = []parser.DocumentElement{}
+		for _, e := range paragraph.Text {
+			elements = append(elements, quotes.Element(e))
+		}
+	}
+
+	class := paragraph.Alignment.String()
+	if unindented {
+		class = strings.TrimSpace(class + " first")
+	}
 	children := []interface{}{}
-	for _, e := range paragraph.Text {
+	if dropCap {
+		if first, rest, ok := util.SplitFirstLetter(elements); ok {
+			letter := []interface{}{}
+			for _, e := range first {
+				letter = append(letter, r.renderElement(e))
+			}
+			children = append(
+				children,
+				span{Class: r.class("drop_cap"), Children: letter},
+			)
+			class = strings.TrimSpace(class + " opening")
+			elements = rest
+		}
+	}
+
+	for _, e := range elements {
 		children = append(children, r.renderElement(e))
 	}
 
-	return p{Children: children}
+	return p{Class: r.class(class), Children: children}
+}
+
+func (r *Renderer) renderImage(image parser.Image) figure {
+	children := []interface{}{img{Src: image.Path, Alt: image.Caption}}
+	if image.Caption != "" {
+		children = append(children, figcaption{Text: image.Caption})
+	}
+	return figure{Class: r.class("illustration"), Children: children}
+}
+
+func (r *Renderer) renderVerse(verse parser.VerseBlock) p {
+	children := []interface{}{}
+	quotes := r.typographer()
+	for i, line := range verse.Lines {
+		if i != 0 {
+			children = append(children, br{})
+		}
+		for _, e := range line {
+			if quotes != nil {
+				e = quotes.Element(e)
+			}
+			children = append(children, r.renderElement(e))
+		}
+		if quotes != nil {
+			quotes.LineBreak()
+		}
+	}
+
+	return p{Class: r.class("verse"), Children: children}
+}
+
+// typographer returns a new Typographer for a paragraph's text, or nil
+// if its text is left as it was written.
+func (r *Renderer) typographer() *util.Typographer {
+	if !r.typography && r.dialogueStyle == nil {
+		return nil
+	}
+	return &util.Typographer{Curly: r.typography, Dialogue: r.dialogueStyle}
 }
 
 func (r *Renderer) renderElement(element parser.DocumentElement) interface{} {
@@ -413,6 +1138,25 @@ func (r *Renderer) renderElement(element parser.DocumentElement) interface{} {
 		return strong{Text: string(e)}
 	case parser.BoldItalicText:
 		return strong{Child: em{Text: string(e)}}
+	case parser.UnderlineText:
+		return u{Text: string(e)}
+	case parser.Footnote:
+		r.footnotes = append(r.footnotes, string(e))
+		n := len(r.footnotes)
+		return sup{
+			Child: a{
+				Name: fmt.Sprintf("footnote_ref_%d", n),
+				HREF: fmt.Sprintf("#footnote_%d", n),
+				Text: fmt.Sprint(n),
+			},
+		}
+	case parser.StrikethroughText:
+		return del{Child: r.renderElement(e.Text)}
+	case parser.ColoredText:
+		return span{
+			Style:    "color:" + e.Color,
+			Children: []interface{}{r.renderElement(e.Text)},
+		}
 	default:
 		panic(
 			errors.New(
@@ -421,3 +1165,128 @@ func (r *Renderer) renderElement(element parser.DocumentElement) interface{} {
 		)
 	}
 }
+
+// Footnotes are numbered in the order they were rendered, so this has
+// to be called after the rest of the document has been rendered.
+func (r *Renderer) renderFootnotes() div {
+	children := []interface{}{}
+	for i, note := range r.footnotes {
+		n := i + 1
+		children = append(
+			children,
+			li{
+				Children: []interface{}{
+					a{Name: fmt.Sprintf("footnote_%d", n)},
+					span{Text: note},
+					a{HREF: fmt.Sprintf("#footnote_ref_%d", n), Text: "↩"},
+				},
+			},
+		)
+	}
+
+	return div{
+		Class:    r.class("footnotes"),
+		Children: []interface{}{ol{Children: children}},
+	}
+}
+
+// article wraps the body of the document in an <article> when the
+// semantic option is set, and a <div> otherwise.
+func (r *Renderer) article(class string, children []interface{}) interface{} {
+	if r.semantic {
+		return article{Class: r.class(class), Children: children}
+	}
+	return div{Class: r.class(class), Children: children}
+}
+
+// section wraps a part, chapter or scene in a <section> when the
+// semantic option is set, and a <div> otherwise.
+func (r *Renderer) section(class string, children []interface{}) interface{} {
+	if r.semantic {
+		return section{Class: r.class(class), Children: children}
+	}
+	return div{Class: r.class(class), Children: children}
+}
+
+// buildAnchors works out the anchor name for each titled part,
+// chapter, and section when the slugAnchors option is set, keyed by
+// the numbered anchor name it replaces.  Titles that come out the same
+// get a number added to keep them unique.
+func (r *Renderer) buildAnchors() map[string]string {
+	anchors := map[string]string{}
+	if !r.slugAnchors {
+		return anchors
+	}
+
+	used := map[string]bool{}
+	add := func(key, title string) {
+		base := slugify(title)
+		if base == "" {
+			return
+		}
+
+		slug := base
+		for n := 2; used[slug]; n++ {
+			slug = fmt.Sprintf("%s-%d", base, n)
+		}
+		used[slug] = true
+		anchors[key] = slug
+	}
+
+	for _, p := range r.document.Parts {
+		if !p.Anonymous {
+			add(fmt.Sprintf("part_%d", p.Number), p.Title)
+		}
+		for _, c := range p.Chapters {
+			prefix := chapterAnchorName(p.Number, c)
+			if !c.Anonymous {
+				add(prefix, c.Title)
+			}
+
+			n := 0
+			for _, s := range c.Scenes {
+				for _, sec := range s.Sections {
+					if sec.Title != "" {
+						n++
+						add(fmt.Sprintf("%s_section_%d", prefix, n), sec.Title)
+					}
+				}
+			}
+		}
+	}
+	return anchors
+}
+
+// chapterAnchorName returns the numbered anchor name for a chapter,
+// which also prefixes the anchor names of its titled sections.
+func chapterAnchorName(partNumber int, chapter parser.Chapter) string {
+	if chapter.Prologue {
+		return fmt.Sprintf("prologue_%d_%d", partNumber, chapter.Number)
+	}
+	return fmt.Sprintf("chapter_%d_%d", partNumber, chapter.Number)
+}
+
+// anchor returns the name of the anchor for a part, chapter, or
+// section, given the format and numbers for its numbered anchor name.
+// Untitled parts and chapters always keep their numbered names.
+func (r *Renderer) anchor(format string, numbers ...interface{}) string {
+	name := fmt.Sprintf(format, numbers...)
+	if slug, ok := r.anchors[name]; ok {
+		return slug
+	}
+	return name
+}
+
+// class adds the class prefix, if there is one, to each of the
+// space-separated class names given.
+func (r *Renderer) class(names string) string {
+	if r.classPrefix == "" {
+		return names
+	}
+
+	classes := strings.Fields(names)
+	for i := range classes {
+		classes[i] = r.classPrefix + classes[i]
+	}
+	return strings.Join(classes, " ")
+}
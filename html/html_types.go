@@ -24,6 +24,8 @@ import (
 
 type document struct {
 	XMLName xml.Name `xml:"html"`
+	Lang    string   `xml:"lang,attr"`
+	Dir     string   `xml:"dir,attr,omitempty"`
 	Head    header
 	Body    body
 }
@@ -31,13 +33,53 @@ type document struct {
 type header struct {
 	XMLName    xml.Name `xml:"head"`
 	Title      string   `xml:"title"`
+	Meta       []meta
 	StyleSheet *link
 	Style      *style
 }
 
+type meta struct {
+	XMLName  xml.Name `xml:"meta"`
+	Name     string   `xml:"name,attr,omitempty"`
+	Property string   `xml:"property,attr,omitempty"`
+	Content  string   `xml:"content,attr"`
+}
+
 type body struct {
 	XMLName xml.Name `xml:"body"`
-	Content div
+	Content interface{}
+}
+
+type img struct {
+	XMLName xml.Name `xml:"img"`
+	Class   string   `xml:"class,attr,omitempty"`
+	Style   string   `xml:"style,attr,omitempty"`
+	Src     string   `xml:"src,attr"`
+	Alt     string   `xml:"alt,attr"`
+}
+
+type figure struct {
+	XMLName  xml.Name `xml:"figure"`
+	Class    string   `xml:"class,attr"`
+	Style    string   `xml:"style,attr,omitempty"`
+	Children []interface{}
+}
+
+type figcaption struct {
+	XMLName xml.Name `xml:"figcaption"`
+	Text    string   `xml:",chardata"`
+}
+
+type details struct {
+	XMLName  xml.Name `xml:"details"`
+	Class    string   `xml:"class,attr"`
+	Summary  summary
+	Children []interface{}
+}
+
+type summary struct {
+	XMLName xml.Name `xml:"summary"`
+	Text    string   `xml:",chardata"`
 }
 
 type link struct {
@@ -55,35 +97,69 @@ type style struct {
 type div struct {
 	XMLName  xml.Name `xml:"div"`
 	Class    string   `xml:"class,attr"`
+	Style    string   `xml:"style,attr,omitempty"`
+	Children []interface{}
+}
+
+type article struct {
+	XMLName  xml.Name `xml:"article"`
+	Class    string   `xml:"class,attr"`
+	Style    string   `xml:"style,attr,omitempty"`
+	Children []interface{}
+}
+
+type section struct {
+	XMLName  xml.Name `xml:"section"`
+	Class    string   `xml:"class,attr"`
+	Style    string   `xml:"style,attr,omitempty"`
 	Children []interface{}
 }
 
 type h1 struct {
 	XMLName xml.Name `xml:"h1"`
+	Style   string   `xml:"style,attr,omitempty"`
 	Title   string   `xml:",chardata"`
 }
 
 type h2 struct {
 	XMLName  xml.Name `xml:"h2"`
+	Style    string   `xml:"style,attr,omitempty"`
 	Children []interface{}
 }
 
 type h3 struct {
 	XMLName  xml.Name `xml:"h3"`
+	Style    string   `xml:"style,attr,omitempty"`
 	Children []interface{}
 }
 
+type h4 struct {
+	XMLName  xml.Name `xml:"h4"`
+	Style    string   `xml:"style,attr,omitempty"`
+	Children []interface{}
+}
+
+type h5 struct {
+	XMLName xml.Name `xml:"h5"`
+	Class   string   `xml:"class,attr,omitempty"`
+	Style   string   `xml:"style,attr,omitempty"`
+	Text    string   `xml:",chardata"`
+}
+
 type p struct {
 	XMLName  xml.Name      `xml:"p"`
 	Class    string        `xml:"class,attr,omitempty"`
+	Style    string        `xml:"style,attr,omitempty"`
 	Text     string        `xml:",chardata"`
 	Children []interface{} `xml:",omitempty"`
 }
 
 type span struct {
-	XMLName xml.Name `xml:"span"`
-	Class   string   `xml:"class,attr,omitempty"`
-	Text    string   `xml:",chardata"`
+	XMLName  xml.Name      `xml:"span"`
+	Class    string        `xml:"class,attr,omitempty"`
+	Style    string        `xml:"style,attr,omitempty"`
+	Text     string        `xml:",chardata"`
+	Children []interface{} `xml:",omitempty"`
 }
 
 type em struct {
@@ -97,6 +173,21 @@ type strong struct {
 	Child   interface{} `xml:",omitempty"`
 }
 
+type u struct {
+	XMLName xml.Name `xml:"u"`
+	Text    string   `xml:",chardata"`
+}
+
+type del struct {
+	XMLName xml.Name `xml:"del"`
+	Child   interface{}
+}
+
+type sup struct {
+	XMLName xml.Name `xml:"sup"`
+	Child   interface{}
+}
+
 type a struct {
 	XMLName xml.Name `xml:"a"`
 	Name    string   `xml:"name,attr,omitempty"`
@@ -108,9 +199,14 @@ type br struct {
 	XMLName xml.Name `xml:"br"`
 }
 
+type pagebreak struct {
+	XMLName xml.Name `xml:"mbp:pagebreak"`
+}
+
 type ol struct {
 	XMLName  xml.Name `xml:"ol"`
 	Class    string   `xml:"class,attr,omitempty"`
+	Style    string   `xml:"style,attr,omitempty"`
 	Children []interface{}
 }
 
@@ -118,3 +214,10 @@ type li struct {
 	XMLName  xml.Name `xml:"li"`
 	Children []interface{}
 }
+
+// rawDiv writes its content out exactly as given, without escaping.
+type rawDiv struct {
+	XMLName xml.Name `xml:"div"`
+	Class   string   `xml:"class,attr"`
+	Content string   `xml:",innerxml"`
+}
@@ -0,0 +1,219 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package html
+
+import (
+	"strings"
+)
+
+// kindleStyles are the kindle profile's stand-in for inlineStyle.
+// Kindle's converter ignores or mangles much of a style sheet, along
+// with positioning, floats and fixed widths, so these stick to fonts,
+// alignment and margins, and are written out on each element.  They're
+// keyed by a tag, by a tag and one of its classes as in "p.verse", or
+// by a class and a tag inside of it as in "epigraph p".
+var kindleStyles = map[string]string{
+	"h1":                   "font-size: 2em; text-align: center",
+	"h2":                   "font-size: 2em; text-align: center",
+	"h3":                   "font-size: 1.5em",
+	"h4":                   "font-size: 1.25em",
+	"h5.scene_number":      "font-size: 1em; text-align: center",
+	"div.author_info":      "font-family: monospace; font-size: 0.75em",
+	"img.cover":            "display: block; margin: 0em auto",
+	"p":                    "text-indent: 1.5em; margin: 0em",
+	"p.byline":             "text-align: center",
+	"p.date":               "text-align: center",
+	"p.word_count":         "text-align: center",
+	"table_of_contents ol": "list-style: square",
+	"numbered ol":          "list-style: decimal",
+	"plain ol":             "list-style: none",
+	"div.epigraph":         "font-style: italic; text-align: right",
+	"p.attribution":        "font-style: normal",
+	"div.footnotes":        "font-size: 0.8em; margin-top: 2em",
+	"div.dedication":       "font-style: italic; text-align: center",
+	"front_matter p":       "text-indent: 0em",
+	"epigraph p":           "text-indent: 0em",
+	"dedication p":         "text-indent: 0em; margin: 1em 0em",
+	"span.drop_cap":        "font-size: 2em",
+	"p.first":              "text-indent: 0em",
+	"p.opening":            "text-indent: 0em",
+	"p.scene_break":        "text-indent: 0em; text-align: center",
+	"p.end_marker":         "text-indent: 0em; text-align: center",
+	"p.verse":              "text-indent: 0em; margin: 0em 3em",
+	"figure.illustration":  "text-align: center",
+	"p.left":               "text-indent: 0em; text-align: left",
+	"p.center":             "text-indent: 0em; text-align: center",
+	"p.right":              "text-indent: 0em; text-align: right",
+	"p.scene_label": "text-indent: 0em; text-align: center; " +
+		"font-style: italic",
+}
+
+// kindleRTLStyles take the place of the kindleStyles that name a side,
+// for stories that run from right to left.
+var kindleRTLStyles = map[string]string{
+	"div.epigraph": "font-style: italic; text-align: left",
+}
+
+// pageBreak starts a new page before a heading in the kindle profile,
+// unless the heading is the first thing in the book.
+func (r *Renderer) pageBreak() []interface{} {
+	started := r.bodyStarted
+	r.bodyStarted = true
+	if r.profile != "kindle" || !started {
+		return nil
+	}
+	return []interface{}{pagebreak{}}
+}
+
+// styleForKindle fills in the inline style of each element, and of
+// everything inside of them, from kindleStyles.  within lists the
+// classes of the elements they sit inside of.
+func (r *Renderer) styleForKindle(
+	elements []interface{},
+	within []string,
+) []interface{} {
+	styled := make([]interface{}, len(elements))
+	for i, e := range elements {
+		styled[i] = r.styleElementForKindle(e, within)
+	}
+	return styled
+}
+
+func (r *Renderer) styleElementForKindle(
+	element interface{},
+	within []string,
+) interface{} {
+	// inside lists the classes for the children of an element with
+	// the given classes.
+	inside := func(class string) []string {
+		return append(append([]string{}, within...), r.classNames(class)...)
+	}
+
+	switch e := element.(type) {
+	case article:
+		e.Style = r.kindleStyle("article", e.Class, within)
+		e.Children = r.styleForKindle(e.Children, inside(e.Class))
+		return e
+	case section:
+		e.Style = r.kindleStyle("section", e.Class, within)
+		e.Children = r.styleForKindle(e.Children, inside(e.Class))
+		return e
+	case div:
+		e.Style = r.kindleStyle("div", e.Class, within)
+		e.Children = r.styleForKindle(e.Children, inside(e.Class))
+		return e
+	case figure:
+		e.Style = r.kindleStyle("figure", e.Class, within)
+		e.Children = r.styleForKindle(e.Children, inside(e.Class))
+		return e
+	case details:
+		e.Children = r.styleForKindle(e.Children, inside(e.Class))
+		return e
+	case ol:
+		e.Style = r.kindleStyle("ol", e.Class, within)
+		e.Children = r.styleForKindle(e.Children, inside(e.Class))
+		return e
+	case li:
+		e.Children = r.styleForKindle(e.Children, within)
+		return e
+	case p:
+		e.Style = r.kindleStyle("p", e.Class, within)
+		e.Children = r.styleForKindle(e.Children, inside(e.Class))
+		return e
+	case span:
+		// Colored text already has a style of its own.
+		if e.Style == "" {
+			e.Style = r.kindleStyle("span", e.Class, within)
+		}
+		e.Children = r.styleForKindle(e.Children, inside(e.Class))
+		return e
+	case img:
+		e.Style = r.kindleStyle("img", e.Class, within)
+		return e
+	case h1:
+		e.Style = r.kindleStyle("h1", "", within)
+		return e
+	case h2:
+		e.Style = r.kindleStyle("h2", "", within)
+		return e
+	case h3:
+		e.Style = r.kindleStyle("h3", "", within)
+		return e
+	case h4:
+		e.Style = r.kindleStyle("h4", "", within)
+		return e
+	case h5:
+		e.Style = r.kindleStyle("h5", e.Class, within)
+		return e
+	case []interface{}:
+		// Conditional blocks come out as a bare run of paragraphs.
+		return r.styleForKindle(e, within)
+	}
+	return element
+}
+
+// kindleStyle puts together the inline style for an element with the
+// given tag and classes, inside of elements with the within classes.
+// Later rules take precedence, so the rules for a tag come first, then
+// those for its classes, then those for what it's inside of, and each
+// property is written once with the last value it was given.
+func (r *Renderer) kindleStyle(tag, class string, within []string) string {
+	properties := []string{}
+	values := map[string]string{}
+	add := func(key string) {
+		rule, ok := kindleRTLStyles[key]
+		if !ok || !r.document.RightToLeft() {
+			rule, ok = kindleStyles[key]
+		}
+		if !ok {
+			return
+		}
+
+		for _, declaration := range strings.Split(rule, "; ") {
+			parts := strings.SplitN(declaration, ": ", 2)
+			if _, ok := values[parts[0]]; !ok {
+				properties = append(properties, parts[0])
+			}
+			values[parts[0]] = parts[1]
+		}
+	}
+
+	add(tag)
+	for _, c := range r.classNames(class) {
+		add(tag + "." + c)
+	}
+	for _, c := range within {
+		add(c + " " + tag)
+	}
+
+	declarations := make([]string, len(properties))
+	for i, property := range properties {
+		declarations[i] = property + ": " + values[property]
+	}
+	return strings.Join(declarations, "; ")
+}
+
+// classNames splits up a class attribute, without the class prefix.
+func (r *Renderer) classNames(class string) []string {
+	names := strings.Fields(class)
+	for i := range names {
+		names[i] = strings.TrimPrefix(names[i], r.classPrefix)
+	}
+	return names
+}
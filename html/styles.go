@@ -18,12 +18,20 @@
 
 package html
 
+import (
+	"regexp"
+)
+
+// classSelector matches the class names in inlineStyle, so that they
+// can be given the class prefix.
+var classSelector = regexp.MustCompile(`\.([A-Za-z_][\w-]*)`)
+
 const inlineStyle = `
 body {
 	font-size: 20px;
 }
 
-div.container {
+.container {
 	width: 800px;
 	margin-left: auto;
 	margin-right: auto;
@@ -39,25 +47,35 @@ h1 {
 	text-align: center;
 }
 
-div.short_story h1 {
+.short_story h1 {
 	font-size: 48px;
 	text-align: center;
 	padding-top: 60px;
 }
 
+img.cover {
+	display: block;
+	max-width: 100%;
+	margin: 0px auto;
+}
+
 p.byline {
 	text-align: center;
 }
 
+p.date {
+	text-align: center;
+}
+
 p.word_count {
 	text-align: center;
 }
 
-div.short_story {
+.short_story {
 	position: relative;
 }
 
-div.short_story p.word_count {
+.short_story p.word_count {
 	display: block;
 	position: absolute;
 	top: 0px;
@@ -78,8 +96,27 @@ div.table_of_contents li ol {
 	list-style: disc;
 }
 
-div.scene {
-	border-bottom: 2px solid #eeeeee;
+div.epigraph {
+	font-style: italic;
+	text-align: right;
+}
+
+div.epigraph p.attribution {
+	font-style: normal;
+}
+
+div.footnotes {
+	font-size: 16px;
+	border-top: 2px solid #eeeeee;
+}
+
+.scene + .scene {
+	border-top: 2px solid #eeeeee;
+}
+
+p.scene_break {
+	text-indent: 0px;
+	text-align: center;
 }
 
 h2 {
@@ -91,11 +128,121 @@ h3 {
 	font-size: 28px;
 }
 
+h4 {
+	font-size: 24px;
+}
+
+h5.scene_number {
+	text-align: center;
+	font-size: 18px;
+}
+
 p {
 	text-indent: 60px;
 }
 
-div.front_matter p {
+div.dedication {
+	font-style: italic;
+	text-align: center;
+	margin: 60px 0px;
+}
+
+div.front_matter p, div.epigraph p, div.dedication p {
+	text-indent: 0px;
+}
+
+span.drop_cap {
+	float: left;
+	font-size: 3.5em;
+	line-height: 0.85;
+	margin: 6px 8px 0px 0px;
+}
+
+p.first, p.opening {
 	text-indent: 0px;
 }
+
+p.end_marker {
+	text-indent: 0px;
+	text-align: center;
+	margin-top: 40px;
+}
+
+p.scene_label {
+	text-indent: 0px;
+	text-align: center;
+	font-style: italic;
+}
+
+p.verse {
+	text-indent: 0px;
+	margin-left: 60px;
+}
+
+figure.illustration {
+	text-align: center;
+}
+
+figure.illustration img {
+	max-width: 100%;
+}
+
+p.left, p.center, p.right {
+	text-indent: 0px;
+}
+
+p.center {
+	text-align: center;
+}
+
+p.right {
+	text-align: right;
+}
+
+p.scene_break.left {
+	text-align: left;
+}
+`
+
+// rtlStyle is added to inlineStyle for stories that run from right to
+// left.  Most of the page follows the direction on its own, so only the
+// rules that name a side need to be flipped.
+const rtlStyle = `
+.short_story p.word_count {
+	right: auto;
+	left: 0px;
+}
+
+div.table_of_contents {
+	padding: 4px 4px 4px 16px;
+}
+
+div.epigraph {
+	text-align: left;
+}
+
+span.drop_cap {
+	float: right;
+	margin: 6px 0px 0px 8px;
+}
+
+p.verse {
+	margin-left: 0px;
+	margin-right: 60px;
+}
 `
+
+// tocListStyles are added to the style sheet for the tocStyle option,
+// keyed by style.  The default bulleted contents need nothing more.
+var tocListStyles = map[string]string{
+	"numbered": `
+div.table_of_contents.numbered ol {
+	list-style: decimal;
+}
+`,
+	"plain": `
+div.table_of_contents.plain ol {
+	list-style: none;
+}
+`,
+}
@@ -22,13 +22,9 @@ import (
 	"bytes"
 	"io"
 	"strings"
+	"unicode"
 )
 
-func argIsTrue(arg string) bool {
-	arg = strings.ToLower(arg)
-	return arg == "t" || arg == "true" || arg == "yes" || arg == "y"
-}
-
 type selfClosingRemover struct {
 	dest io.Writer
 }
@@ -43,13 +39,39 @@ func (s selfClosingRemover) Write(p []byte) (n int, err error) {
 	n = len(p)
 	toRemove := []string{
 		"br",
+		"img",
 		"link",
+		"meta",
+		"mbp:pagebreak",
 	}
 
 	for _, tag := range toRemove {
 		p = bytes.Replace(p, []byte("</"+tag+">"), []byte{}, -1)
 	}
 
+	// The XML encoder has no entity for a non-breaking space, but it's
+	// easier to spot in the page's source as one.
+	p = bytes.Replace(p, []byte("\u00a0"), []byte("&nbsp;"), -1)
+
 	_, err = s.dest.Write(p)
 	return
 }
+
+// slugify turns a title into a lowercase anchor name, with every run
+// of characters other than letters and digits replaced by a hyphen.
+func slugify(title string) string {
+	slug := []rune{}
+	hyphen := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && len(slug) != 0 {
+				slug = append(slug, '-')
+			}
+			slug = append(slug, r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+	return string(slug)
+}
@@ -0,0 +1,61 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bieber/manuscript/parser"
+	"github.com/bieber/manuscript/renderers"
+	"io"
+)
+
+// Renderer provides a Render method to render the given document to
+// JSON.
+type Renderer struct {
+	document parser.Document
+}
+
+// Options lists the options accepted by New.
+var Options = []renderers.OptionSpec{}
+
+func init() {
+	renderers.Register("json", New, Options...)
+}
+
+// New constructs a new Renderer for the given document and
+// command-line arguments.
+func New(
+	document parser.Document,
+	options map[string]string,
+) (renderers.Renderer, error) {
+	for k := range options {
+		return nil, fmt.Errorf("Invalid JSON option %s", k)
+	}
+
+	return &Renderer{document: document}, nil
+}
+
+// Render writes the requested document out to the specified io.Writer
+// as JSON.
+func (r *Renderer) Render(fout io.Writer) error {
+	encoder := json.NewEncoder(fout)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(r.document)
+}
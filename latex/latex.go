@@ -0,0 +1,487 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package latex
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/bieber/manuscript/parser"
+	"github.com/bieber/manuscript/renderers"
+	"github.com/bieber/manuscript/util"
+	"io"
+	"strings"
+)
+
+// Renderer provides a Render method to render the given document to a
+// LaTeX source file.
+type Renderer struct {
+	labels     util.Labels
+	sceneBreak renderers.SceneSeparator
+	document   parser.Document
+	buffer     bytes.Buffer
+}
+
+// Options lists the options accepted by New.
+var Options = append(
+	renderers.NewSceneSeparator("***").Options(),
+	util.LabelOptions...,
+)
+
+func init() {
+	renderers.Register("latex", New, Options...)
+}
+
+// New constructs a new Renderer for the given document and
+// command-line arguments.
+func New(
+	document parser.Document,
+	options map[string]string,
+) (renderers.Renderer, error) {
+	renderer := Renderer{
+		labels:     util.DefaultLabels,
+		sceneBreak: renderers.NewSceneSeparator("***"),
+		document:   document,
+	}
+
+	for k, v := range options {
+		switch k {
+		case "sceneBreak", "sceneBreakAlignment":
+			if err := renderer.sceneBreak.Set(k, v); err != nil {
+				return nil, err
+			}
+		case "partLabel", "chapterLabel", "prologueLabel",
+			"numberStyle", "partNumberStyle", "labelSeparator":
+			if err := renderer.labels.Set(k, v); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("Invalid LaTeX option %s", k)
+		}
+	}
+
+	return &renderer, nil
+}
+
+// Render writes the requested document out to the specified io.Writer
+// as a LaTeX document.
+func (r *Renderer) Render(fout io.Writer) error {
+	r.buffer.Reset()
+
+	if err := r.writePreamble(); err != nil {
+		return err
+	}
+
+	for _, p := range r.document.Parts {
+		if err := r.renderPart(p); err != nil {
+			return err
+		}
+	}
+
+	if _, err := r.buffer.WriteString("\\end{document}\n"); err != nil {
+		return err
+	}
+
+	_, err := r.buffer.WriteTo(fout)
+	return err
+}
+
+// Novels are typeset as books and short stories as articles.  The
+// article class has no chapters, so a short story's chapters become
+// sections instead.
+func (r *Renderer) documentClass() string {
+	if r.document.Type == parser.Novel {
+		return "book"
+	}
+	return "article"
+}
+
+func (r *Renderer) writePreamble() error {
+	document := r.document
+
+	authors := []string{}
+	for _, a := range document.Authors() {
+		if a.Byline != "" {
+			authors = append(authors, escape(a.Byline))
+		}
+	}
+
+	date := ""
+	if !document.Date.IsZero() {
+		date = document.Date.Format("January 2, 2006")
+	}
+
+	lines := []string{
+		`\documentclass{` + r.documentClass() + `}`,
+		`\usepackage[utf8]{inputenc}`,
+		`\usepackage[T1]{fontenc}`,
+		`\usepackage[normalem]{ulem}`,
+		`\usepackage{graphicx}`,
+		``,
+	}
+
+	// LaTeX numbers parts and chapters itself, so custom labels are
+	// passed along by renaming them.
+	if r.labels.Part != util.DefaultLabels.Part {
+		lines = append(
+			lines,
+			`\renewcommand{\partname}{`+escape(r.labels.Part)+`}`,
+		)
+	}
+	if r.labels.Chapter != util.DefaultLabels.Chapter &&
+		r.documentClass() == "book" {
+		lines = append(
+			lines,
+			`\renewcommand{\chaptername}{`+escape(r.labels.Chapter)+`}`,
+		)
+	}
+
+	chapterCounter := "chapter"
+	if r.documentClass() == "article" {
+		chapterCounter = "section"
+	}
+	if r.labels.PartNumbers == "words" || r.labels.ChapterNumbers == "words" {
+		lines = append(lines, `\usepackage{fmtcount}`)
+	}
+	if r.labels.PartNumbers != util.DefaultLabels.PartNumbers {
+		lines = append(lines, renumber("part", r.labels.PartNumbers))
+	}
+	if r.labels.ChapterNumbers != util.DefaultLabels.ChapterNumbers {
+		lines = append(lines, renumber(chapterCounter, r.labels.ChapterNumbers))
+	}
+
+	lines = append(
+		lines,
+		`\title{`+escape(document.Title)+`}`,
+		`\author{`+strings.Join(authors, ` \and `)+`}`,
+		`\date{`+escape(date)+`}`,
+		``,
+		`\begin{document}`,
+		``,
+		`\maketitle`,
+		``,
+		``,
+	)
+
+	_, err := r.buffer.WriteString(strings.Join(lines, "\n"))
+	return err
+}
+
+func (r *Renderer) renderPart(part parser.Part) error {
+	if !part.Anonymous {
+		_, err := r.buffer.WriteString(`\part{` + escape(part.Title) + "}\n\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, c := range part.Chapters {
+		if err := r.renderChapter(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Renderer) renderChapter(chapter parser.Chapter) error {
+	if !chapter.Anonymous {
+		command := `\chapter`
+		if r.documentClass() == "article" {
+			command = `\section`
+		}
+
+		// Prologues aren't numbered, so they get the starred form of
+		// the command, and have to be added to the contents by hand.
+		text := command + `{` + escape(chapter.Title) + "}\n\n"
+		if chapter.Prologue {
+			title := r.labels.PrologueLabel(chapter.Title)
+			text = fmt.Sprintf(
+				"%s*{%s}\n\\addcontentsline{toc}{%s}{%s}\n\n",
+				command,
+				escape(title),
+				command[1:],
+				escape(title),
+			)
+		}
+
+		// LaTeX counts chapters itself, so the counter is set to match
+		// the chapter's own number in case earlier chapters were left
+		// out.
+		if !chapter.Prologue {
+			text = fmt.Sprintf(
+				"\\setcounter{%s}{%d}\n%s",
+				command[1:],
+				chapter.Number-1,
+				text,
+			)
+		}
+
+		if _, err := r.buffer.WriteString(text); err != nil {
+			return err
+		}
+	}
+
+	if chapter.Epigraph != nil {
+		if err := r.renderEpigraph(*chapter.Epigraph); err != nil {
+			return err
+		}
+	}
+
+	for i, s := range chapter.Scenes {
+		if err := r.renderScene(s); err != nil {
+			return err
+		}
+
+		if i != len(chapter.Scenes)-1 {
+			if err := r.renderSceneBreak(s.BreakLabel); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *Renderer) renderSceneBreak(label string) error {
+	text := "\\bigskip\n\n"
+	if !r.sceneBreak.Blank() {
+		alignment := "\\centering"
+		switch r.sceneBreak.Alignment {
+		case parser.LeftAlignment:
+			alignment = "\\raggedright"
+		case parser.RightAlignment:
+			alignment = "\\raggedleft"
+		}
+
+		text = "\\bigskip{" + alignment + " " +
+			escape(r.sceneBreak.Glyph) + " \\par}\n\n"
+	}
+
+	if label != "" {
+		text += "{\\centering\\itshape " + escape(label) + " \\par}\n\n"
+	}
+
+	_, err := r.buffer.WriteString(text)
+	return err
+}
+
+func (r *Renderer) renderEpigraph(epigraph parser.Epigraph) error {
+	text := `\textit{` + escape(epigraph.Text) + `}`
+	if epigraph.Attribution != "" {
+		text += ` \\` + "\n--- " + escape(epigraph.Attribution)
+	}
+
+	_, err := r.buffer.WriteString(
+		"\\begin{flushright}\n" + text + "\n\\end{flushright}\n\n",
+	)
+	return err
+}
+
+func (r *Renderer) renderScene(scene parser.Scene) error {
+	for _, s := range scene.Sections {
+		if err := r.renderSection(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Renderer) renderSection(section parser.Section) error {
+	if section.Title != "" {
+		_, err := r.buffer.WriteString(
+			"\\begin{center}\n\\textbf{" + escape(section.Title) +
+				"}\n\\end{center}\n\n",
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, p := range section.Paragraphs {
+		if err := r.renderParagraph(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Renderer) renderParagraph(paragraph parser.Paragraph) error {
+	if !paragraph.RenderedBy("latex") {
+		return nil
+	}
+	if verse, ok := paragraph.Verse(); ok {
+		return r.renderVerse(verse)
+	}
+	if raw, ok := paragraph.Raw(); ok {
+		return r.renderRaw(raw)
+	}
+	if block, ok := paragraph.Conditional(); ok {
+		for _, p := range block.Paragraphs {
+			if err := r.renderParagraph(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// There's no way to hide text here, so spoilers are shown as they
+	// are.
+	if spoiler, ok := paragraph.Spoiler(); ok {
+		for _, p := range spoiler.Paragraphs {
+			if err := r.renderParagraph(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if image, ok := paragraph.Image(); ok {
+		return r.renderImage(image)
+	}
+
+	text := ""
+	for _, e := range paragraph.Text {
+		text += r.renderElement(e)
+	}
+
+	environment := ""
+	switch paragraph.Alignment {
+	case parser.LeftAlignment:
+		environment = "flushleft"
+	case parser.CenterAlignment:
+		environment = "center"
+	case parser.RightAlignment:
+		environment = "flushright"
+	}
+	if environment != "" {
+		text = fmt.Sprintf(
+			"\\begin{%s}\n%s\n\\end{%s}",
+			environment,
+			text,
+			environment,
+		)
+	}
+
+	_, err := r.buffer.WriteString(text + "\n\n")
+	return err
+}
+
+// renderRaw writes out a raw block exactly as it was written.
+func (r *Renderer) renderRaw(raw parser.RawBlock) error {
+	_, err := r.buffer.WriteString(raw.Content + "\n\n")
+	return err
+}
+
+func (r *Renderer) renderImage(image parser.Image) error {
+	text := `\includegraphics[width=\linewidth]{` + image.Path + `}`
+	if image.Caption != "" {
+		text += ` \\` + "\n" + `\textit{` + escape(image.Caption) + `}`
+	}
+
+	_, err := r.buffer.WriteString(
+		"\\begin{center}\n" + text + "\n\\end{center}\n\n",
+	)
+	return err
+}
+
+func (r *Renderer) renderVerse(verse parser.VerseBlock) error {
+	lines := []string{}
+	for _, line := range verse.Lines {
+		text := ""
+		for _, e := range line {
+			text += r.renderElement(e)
+		}
+		lines = append(lines, text)
+	}
+
+	_, err := r.buffer.WriteString(
+		"\\begin{verse}\n" + strings.Join(lines, " \\\\\n") +
+			"\n\\end{verse}\n\n",
+	)
+	return err
+}
+
+func (r *Renderer) renderElement(element parser.DocumentElement) string {
+	switch e := element.(type) {
+	case parser.PlainText:
+		return escape(string(e))
+	case parser.ItalicText:
+		return `\textit{` + escape(string(e)) + `}`
+	case parser.BoldText:
+		return `\textbf{` + escape(string(e)) + `}`
+	case parser.BoldItalicText:
+		return `\textbf{\textit{` + escape(string(e)) + `}}`
+	case parser.Footnote:
+		return `\footnote{` + escape(string(e)) + `}`
+	case parser.UnderlineText:
+		return `\uline{` + escape(string(e)) + `}`
+	case parser.StrikethroughText:
+		return `\sout{` + r.renderElement(e.Text) + `}`
+	case parser.ColoredText:
+		return r.renderElement(e.Text)
+	default:
+		panic(
+			errors.New(
+				"latex: Unexpected document element passed to renderElement",
+			),
+		)
+	}
+}
+
+// renumber returns the command that makes LaTeX print the given
+// counter in one of the number styles accepted by util.FormatNumber.
+func renumber(counter, style string) string {
+	format := `\arabic`
+	switch style {
+	case "roman":
+		format = `\Roman`
+	case "words":
+		format = `\Numberstring`
+	}
+	return `\renewcommand{\the` + counter + `}{` + format + `{` + counter + `}}`
+}
+
+// latexEscapes maps each character that means something to LaTeX to
+// the command that prints it.
+var latexEscapes = map[rune]string{
+	'\\':                    `\textbackslash{}`,
+	'{':                     `\{`,
+	'}':                     `\}`,
+	'&':                     `\&`,
+	'%':                     `\%`,
+	'$':                     `\$`,
+	'#':                     `\#`,
+	'_':                     `\_`,
+	'~':                     `\textasciitilde{}`,
+	'^':                     `\textasciicircum{}`,
+	parser.SoftHyphen:       `\-`,
+	parser.NonBreakingSpace: `~`,
+}
+
+// escape makes text safe to include in a LaTeX document.
+func escape(text string) string {
+	buf := bytes.Buffer{}
+	for _, r := range text {
+		if escaped, ok := latexEscapes[r]; ok {
+			buf.WriteString(escaped)
+		} else {
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
@@ -19,43 +19,68 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"github.com/bieber/conflag"
-	"github.com/bieber/manuscript/bbcode"
-	"github.com/bieber/manuscript/html"
-	"github.com/bieber/manuscript/markdown"
 	"github.com/bieber/manuscript/parser"
-	"github.com/bieber/manuscript/pdf"
 	"github.com/bieber/manuscript/renderers"
+	_ "github.com/bieber/manuscript/renderers/all"
 	"golang.org/x/crypto/ssh/terminal"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 )
 
 // Config lists the command-line configuration options.
 type Config struct {
-	Help     bool
-	Renderer string
-	Output   string
+	Help          bool
+	Version       bool
+	ListRenderers bool
+	Stats         bool
+	WordsPerPage  int
+	Target        int
+	Check         bool
+	Strict        bool
+	Chapters      string
+	Part          int
+	Renderer      string
+	Output        string
 }
 
+// version is the release of manuscript being run.  Release builds set
+// it with -ldflags "-X main.version=...".
+var version = "unknown"
+
 // Renderer defines a type with a Render method that will write the
 // formatted manuscript out to the given io.Writer
 type Renderer interface {
 	Render(io.Writer) error
 }
 
-var allRenderers = map[string]renderers.RendererConstructor{
-	"pdf":      pdf.New,
-	"html":     html.New,
-	"bbcode":   bbcode.New,
-	"markdown": markdown.New,
+// rendererExtensions maps output file extensions to the renderer used
+// for them when no renderer is given on the command line.
+var rendererExtensions = map[string]string{
+	".pdf":      "pdf",
+	".html":     "html",
+	".htm":      "html",
+	".bbcode":   "bbcode",
+	".md":       "markdown",
+	".markdown": "markdown",
+	".epub":     "epub",
+	".txt":      "text",
+	".json":     "json",
+	".rtf":      "rtf",
+	".tex":      "latex",
+	".gmi":      "gemtext",
 }
 
 func main() {
 	config := &Config{
-		Renderer: "pdf",
+		WordsPerPage: 250,
 	}
 
 	configParser, err := conflag.New(config)
@@ -65,15 +90,43 @@ func main() {
 
 	configParser.ProgramName("manuscript")
 	configParser.ProgramDescription("" +
-		"Usage: manuscript (-o | --output) outfile [options] infile\n\n" +
-		"Format stories in manuscript format.  For input format details, see " +
-		"README file.",
+		"Usage: manuscript (-o | --output) outfile [options] [infile]\n\n" +
+		"Format stories in manuscript format.  If infile is omitted or is " +
+		"-, the story is read from standard input.  For input format " +
+		"details, see README file.",
 	)
 
 	configParser.Field("Help").
 		ShortFlag('h').
 		LongFlag("help").
 		Description("Print usage text and exit.")
+	configParser.Field("Version").
+		LongFlag("version").
+		Description("Print version information and exit.")
+	configParser.Field("ListRenderers").
+		LongFlag("list-renderers").
+		Description("List the available renderers and their options.")
+	configParser.Field("Stats").
+		LongFlag("stats").
+		Description("Print statistics about the story and exit.")
+	configParser.Field("WordsPerPage").
+		LongFlag("words-per-page").
+		Description("Words per page for the --stats page estimate.")
+	configParser.Field("Target").
+		LongFlag("target").
+		Description("Word count goal to measure progress against in --stats.")
+	configParser.Field("Check").
+		LongFlag("check").
+		Description("Check the story for errors without rendering it.")
+	configParser.Field("Strict").
+		LongFlag("strict").
+		Description("Treat missing title or author information as an error.")
+	configParser.Field("Chapters").
+		LongFlag("chapters").
+		Description("Render only a range of chapters, such as 3-5.")
+	configParser.Field("Part").
+		LongFlag("part").
+		Description("Render only the part with the given number.")
 	configParser.Field("Renderer").
 		ShortFlag('r').
 		LongFlag("renderer").
@@ -81,12 +134,29 @@ func main() {
 	configParser.Field("Output").
 		ShortFlag('o').
 		LongFlag("output").
-		Required().
-		Description("File path to write output to.")
+		Description("File path to write output to.  Required.")
 	configParser.AllowExtraArgs("input")
 
 	extraArgs, err := configParser.Read()
-	if err != nil || len(extraArgs) != 1 || config.Help {
+	needsOutput := !config.ListRenderers && !config.Stats && !config.Check &&
+		!config.Version
+	if err == nil && config.Output == "" && needsOutput {
+		err = errors.New("Missing required option -o/--output")
+	}
+	if err == nil && config.WordsPerPage <= 0 {
+		err = fmt.Errorf("Invalid words per page %d", config.WordsPerPage)
+	}
+	if err == nil && config.Target < 0 {
+		err = fmt.Errorf("Invalid word count target %d", config.Target)
+	}
+	if err == nil && config.Part < 0 {
+		err = fmt.Errorf("Invalid part number %d", config.Part)
+	}
+	firstChapter, lastChapter := 0, 0
+	if err == nil && config.Chapters != "" {
+		firstChapter, lastChapter, err = parseChapterRange(config.Chapters)
+	}
+	if err != nil || len(extraArgs) > 1 || config.Help {
 		exitCode := 0
 
 		if err != nil {
@@ -101,18 +171,73 @@ func main() {
 		os.Exit(exitCode)
 	}
 
-	fin, err := os.Open(extraArgs[0])
-	if err != nil {
-		log.Fatal(err)
+	if config.Version {
+		fmt.Printf("manuscript %s (%s)\n", version, runtime.Version())
+		return
 	}
-	defer fin.Close()
 
-	document, err := parser.Parse(fin)
+	if config.ListRenderers {
+		listRenderers()
+		return
+	}
+
+	if config.Renderer == "" && needsOutput {
+		config.Renderer, err = rendererForOutput(config.Output)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Paths in a story read from a file are relative to the file.
+	var document parser.Document
+	if len(extraArgs) == 1 && extraArgs[0] != "-" {
+		document, err = parser.ParseFile(extraArgs[0])
+	} else {
+		document, err = parser.Parse(os.Stdin)
+	}
 	if err != nil {
+		var parseErr *parser.ParseError
+		if errors.As(err, &parseErr) {
+			log.Fatalf("Invalid manuscript: %s", parseErr)
+		}
 		log.Fatal(err)
 	}
 
-	renderer, err := renderers.Resolve(allRenderers, document, config.Renderer)
+	if config.Part != 0 {
+		document = document.SelectPart(config.Part)
+		if len(document.Parts) == 0 {
+			log.Fatalf("No part %d in the story", config.Part)
+		}
+	}
+	if config.Chapters != "" {
+		document = document.SelectChapters(firstChapter, lastChapter)
+		if len(document.Parts) == 0 {
+			log.Fatalf("No chapters %s in the story", config.Chapters)
+		}
+	}
+
+	warnings := document.Validate()
+	for _, w := range warnings {
+		log.Printf("Warning: %s", w)
+	}
+	if config.Strict && len(warnings) != 0 {
+		os.Exit(1)
+	}
+
+	if config.Check {
+		return
+	}
+
+	if config.Stats {
+		printStats(document, config.WordsPerPage, config.Target)
+		return
+	}
+
+	renderer, err := renderers.Resolve(
+		renderers.Default(),
+		document,
+		config.Renderer,
+	)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -127,3 +252,103 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// rendererForOutput picks a renderer based on the extension of the
+// output file.  Files without an extension get the default PDF
+// renderer.
+func rendererForOutput(path string) (string, error) {
+	extension := strings.ToLower(filepath.Ext(path))
+	if extension == "" {
+		return "pdf", nil
+	}
+
+	if name, ok := rendererExtensions[extension]; ok {
+		return name, nil
+	}
+	return "", fmt.Errorf(
+		"No renderer for %s files, use -r/--renderer to choose one",
+		extension,
+	)
+}
+
+// parseChapterRange reads a range of chapter numbers like 3-5, or a
+// single chapter number on its own.
+func parseChapterRange(arg string) (first, last int, err error) {
+	firstArg, lastArg := arg, arg
+	if i := strings.Index(arg, "-"); i != -1 {
+		firstArg, lastArg = arg[:i], arg[i+1:]
+	}
+
+	first, err = strconv.Atoi(strings.TrimSpace(firstArg))
+	if err == nil {
+		last, err = strconv.Atoi(strings.TrimSpace(lastArg))
+	}
+	if err != nil || first < 1 || last < first {
+		return 0, 0, fmt.Errorf("Invalid chapter range %s", arg)
+	}
+	return first, last, nil
+}
+
+func listRenderers() {
+	for _, name := range renderers.Names() {
+		fmt.Println(name)
+		for _, option := range renderers.Options(name) {
+			fmt.Printf(
+				"    %s (default %q): %s\n",
+				option.Name,
+				option.Default,
+				option.Description,
+			)
+		}
+	}
+}
+
+func printStats(document parser.Document, wordsPerPage, target int) {
+	parts := document.PartCount()
+	chapters := document.ChapterCount(true)
+	scenes := document.SceneCount()
+
+	paragraphs := 0
+	for _, p := range document.Parts {
+		for _, c := range p.Chapters {
+			for _, s := range c.Scenes {
+				for _, sec := range s.Sections {
+					paragraphs += len(sec.Paragraphs)
+				}
+			}
+		}
+	}
+
+	words := document.WordCount()
+	wordsPerChapter := int64(0)
+	if chapters != 0 {
+		wordsPerChapter = words / int64(chapters)
+	}
+
+	fmt.Printf("Words:             about %d\n", words)
+	fmt.Printf("Parts:             %d\n", parts)
+	fmt.Printf("Chapters:          %d\n", chapters)
+	fmt.Printf("Scenes:            %d\n", scenes)
+	fmt.Printf("Paragraphs:        %d\n", paragraphs)
+	fmt.Printf("Words per chapter: about %d\n", wordsPerChapter)
+	fmt.Printf(
+		"Pages:             about %d at %d words per page\n",
+		document.PageEstimate(wordsPerPage),
+		wordsPerPage,
+	)
+
+	if target == 0 {
+		return
+	}
+
+	fmt.Printf("Target:            %d\n", target)
+	if remaining := int64(target) - words; remaining > 0 {
+		fmt.Printf("Remaining:         about %d\n", remaining)
+	} else {
+		fmt.Printf("Over target by:    about %d\n", -remaining)
+	}
+	fmt.Printf(
+		"Progress:          %.1f%%\n",
+		100*float64(words)/float64(target),
+	)
+}
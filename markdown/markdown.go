@@ -22,22 +22,57 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"github.com/StefanSchroeder/Golang-Roman"
 	"github.com/bieber/manuscript/parser"
 	"github.com/bieber/manuscript/renderers"
+	"github.com/bieber/manuscript/util"
 	"io"
+	"strconv"
 	"strings"
 )
 
 func escape(s string) string {
-	return strings.ReplaceAll(s, "*", "\\*")
+	s = strings.ReplaceAll(s, "*", "\\*")
+	s = strings.ReplaceAll(s, "~", "\\~")
+	return strings.ReplaceAll(s, "_", "\\_")
 }
 
+// heading escapes the text of a heading, which has to stay on a single
+// line, so a line break from the label separator is written as <br>.
+func heading(s string) string {
+	return strings.Replace(escape(s), "\n", "<br>", -1)
+}
+
+// The default scene break is a markdown thematic break, which is
+// written as is.  Any other scene break is escaped like regular text.
+const defaultSceneBreak = "* * *"
+
 // Renderer provides a Render method to render the given document to
 // markdown text.
 type Renderer struct {
-	document parser.Document
-	buffer   bytes.Buffer
+	frontMatter bool
+	labels      util.Labels
+	sceneBreak  renderers.SceneSeparator
+	document    parser.Document
+	buffer      bytes.Buffer
+}
+
+// Options lists the options accepted by New.
+var Options = append(
+	[]renderers.OptionSpec{
+		{
+			Name:        "frontMatter",
+			Default:     "false",
+			Description: "Begin with a YAML front matter block",
+		},
+	},
+	append(
+		renderers.NewSceneSeparator(defaultSceneBreak).Options(),
+		util.LabelOptions...,
+	)...,
+)
+
+func init() {
+	renderers.Register("markdown", New, Options...)
 }
 
 // New constructs a new Renderer for the given document and
@@ -46,12 +81,43 @@ func New(
 	document parser.Document,
 	options map[string]string,
 ) (renderers.Renderer, error) {
-	return &Renderer{document: document}, nil
+	renderer := Renderer{
+		labels:     util.DefaultLabels,
+		sceneBreak: renderers.NewSceneSeparator(defaultSceneBreak),
+		document:   document,
+	}
+
+	for k, v := range options {
+		switch k {
+		case "frontMatter":
+			renderer.frontMatter = util.ArgIsTrue(v)
+		case "sceneBreak", "sceneBreakAlignment":
+			if err := renderer.sceneBreak.Set(k, v); err != nil {
+				return nil, err
+			}
+		case "partLabel", "chapterLabel", "prologueLabel",
+			"numberStyle", "partNumberStyle", "labelSeparator":
+			if err := renderer.labels.Set(k, v); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("Invalid markdown option %s", k)
+		}
+	}
+
+	return &renderer, nil
 }
 
 // Render writes the requested document out to the specified io.Writer
 // as markdown text.
 func (r *Renderer) Render(fout io.Writer) error {
+	if r.frontMatter {
+		err := r.renderFrontMatter()
+		if err != nil {
+			return err
+		}
+	}
+
 	for _, p := range r.document.Parts {
 		err := r.renderPart(p)
 		if err != nil {
@@ -63,14 +129,27 @@ func (r *Renderer) Render(fout io.Writer) error {
 	return err
 }
 
+// The front matter is written as a YAML block, which static site
+// generators will pick up as the page's metadata.
+func (r *Renderer) renderFrontMatter() error {
+	document := r.document
+
+	lines := []string{"---"}
+	lines = append(lines, "title: "+strconv.Quote(document.Title))
+	if byline := document.Byline(); byline != "" {
+		lines = append(lines, "author: "+strconv.Quote(byline))
+	}
+	lines = append(lines, "---", "", "")
+
+	_, err := r.buffer.WriteString(strings.Join(lines, "\n"))
+	return err
+}
+
 func (r *Renderer) renderPart(part parser.Part) error {
 	if !part.Anonymous {
-		text := "Part " + roman.Roman(part.Number)
-		if part.Title != "" {
-			text += ": " + part.Title
-		}
+		text := r.labels.PartLabel(part.Number, part.Title)
 
-		_, err := r.buffer.WriteString("##" + escape(text) + "##\n\n")
+		_, err := r.buffer.WriteString("# " + heading(text) + "\n\n")
 		if err != nil {
 			return err
 		}
@@ -88,20 +167,19 @@ func (r *Renderer) renderPart(part parser.Part) error {
 
 func (r *Renderer) renderChapter(chapter parser.Chapter) error {
 	if !chapter.Anonymous {
-		text := ""
+		text := r.labels.ChapterLabel(chapter.Number, chapter.Title)
 		if chapter.Prologue {
-			text = "Prologue"
-			if chapter.Title != "" {
-				text += ": " + chapter.Title
-			}
-		} else {
-			text = fmt.Sprintf("Chapter %d", chapter.Number)
-			if chapter.Title != "" {
-				text += ": " + chapter.Title
-			}
+			text = r.labels.PrologueLabel(chapter.Title)
+		}
+
+		_, err := r.buffer.WriteString("## " + heading(text) + "\n\n")
+		if err != nil {
+			return err
 		}
+	}
 
-		_, err := r.buffer.WriteString("###" + escape(text) + "###\n\n")
+	if chapter.Epigraph != nil {
+		err := r.renderEpigraph(*chapter.Epigraph)
 		if err != nil {
 			return err
 		}
@@ -114,7 +192,7 @@ func (r *Renderer) renderChapter(chapter parser.Chapter) error {
 		}
 
 		if i != len(chapter.Scenes)-1 {
-			_, err := r.buffer.WriteString("------\n\n")
+			err := r.renderSceneBreak(s.BreakLabel)
 			if err != nil {
 				return err
 			}
@@ -124,8 +202,64 @@ func (r *Renderer) renderChapter(chapter parser.Chapter) error {
 	return nil
 }
 
+func (r *Renderer) renderEpigraph(epigraph parser.Epigraph) error {
+	text := "> *" + escape(epigraph.Text) + "*\n"
+	if epigraph.Attribution != "" {
+		text += ">\n> — " + escape(epigraph.Attribution) + "\n"
+	}
+
+	_, err := r.buffer.WriteString(text + "\n")
+	return err
+}
+
+// Markdown has no way to align text, so the scene break's alignment
+// is ignored, and its label is only set in italics rather than
+// centered.
+func (r *Renderer) renderSceneBreak(label string) error {
+	text := r.sceneBreak.Glyph
+	if r.sceneBreak.Blank() {
+		text = "&nbsp;"
+	} else if text != defaultSceneBreak {
+		text = escape(text)
+		if strings.HasPrefix(text, "#") {
+			text = "\\" + text
+		}
+	}
+	text += "\n\n"
+
+	if label != "" {
+		text += "*" + escape(label) + "*\n\n"
+	}
+
+	_, err := r.buffer.WriteString(text)
+	return err
+}
+
 func (r *Renderer) renderScene(scene parser.Scene) error {
-	for _, p := range scene.Paragraphs {
+	for _, s := range scene.Sections {
+		err := r.renderSection(s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Renderer) renderSection(section parser.Section) error {
+	if section.Title != "" {
+		_, err := r.buffer.WriteString("### " + escape(section.Title) + "\n\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, p := range section.Paragraphs {
+		// Paragraphs for other renderers are left out entirely, along
+		// with the break after them.
+		if !p.RenderedBy("markdown") {
+			continue
+		}
+
 		err := r.renderParagraph(p)
 		if err != nil {
 			return err
@@ -140,15 +274,86 @@ func (r *Renderer) renderScene(scene parser.Scene) error {
 }
 
 func (r *Renderer) renderParagraph(paragraph parser.Paragraph) error {
-	for _, e := range paragraph.Text {
-		err := r.renderElement(e)
-		if err != nil {
+	if verse, ok := paragraph.Verse(); ok {
+		return r.renderVerse(verse)
+	}
+	if raw, ok := paragraph.Raw(); ok {
+		_, err := r.buffer.WriteString(raw.Content)
+		return err
+	}
+	if block, ok := paragraph.Conditional(); ok {
+		return r.renderParagraphs(block.Paragraphs)
+	}
+	if spoiler, ok := paragraph.Spoiler(); ok {
+		return r.renderParagraphs(spoiler.Paragraphs)
+	}
+	if image, ok := paragraph.Image(); ok {
+		_, err := r.buffer.WriteString(
+			"![" + escape(image.Caption) + "](" + image.Path + ")",
+		)
+		return err
+	}
+
+	return r.renderElements(paragraph.Text)
+}
+
+// renderParagraphs writes out the paragraphs of a block directive,
+// separated the same way as the paragraphs of a section.  The section
+// loop writes the break after the block as a whole, so only the breaks
+// between its paragraphs are written here.
+func (r *Renderer) renderParagraphs(paragraphs []parser.Paragraph) error {
+	for i, p := range paragraphs {
+		if i != 0 {
+			if _, err := r.buffer.WriteString("\n\n"); err != nil {
+				return err
+			}
+		}
+		if err := r.renderParagraph(p); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// Markdown needs two trailing spaces to keep a line break.
+func (r *Renderer) renderVerse(verse parser.VerseBlock) error {
+	var err error
+	for i, line := range verse.Lines {
+		if i != 0 && err == nil {
+			_, err = r.buffer.WriteString("  \n")
+		}
+		if err == nil {
+			err = r.renderElements(line)
+		}
+	}
+	return err
+}
+
+// GFM won't close a strikethrough right after a space, so a run of
+// struck elements is wrapped in a single pair of tildes rather than
+// one pair each, as in ~~struck **and bold**~~.
+func (r *Renderer) renderElements(elements []parser.DocumentElement) error {
+	var err error
+	struck := false
+	for _, e := range elements {
+		s, ok := e.(parser.StrikethroughText)
+		if ok != struck && err == nil {
+			_, err = r.buffer.WriteString("~~")
+			struck = ok
+		}
+		if ok {
+			e = s.Text
+		}
+		if err == nil {
+			err = r.renderElement(e)
+		}
+	}
+	if struck && err == nil {
+		_, err = r.buffer.WriteString("~~")
+	}
+	return err
+}
+
 func (r *Renderer) renderElement(element parser.DocumentElement) error {
 	var err error
 	switch e := element.(type) {
@@ -160,6 +365,20 @@ func (r *Renderer) renderElement(element parser.DocumentElement) error {
 		_, err = r.buffer.WriteString("**" + escape(string(e)) + "**")
 	case parser.BoldItalicText:
 		_, err = r.buffer.WriteString("***" + escape(string(e)) + "***")
+	case parser.Footnote:
+		_, err = r.buffer.WriteString(" (" + escape(string(e)) + ")")
+	case parser.UnderlineText:
+		_, err = r.buffer.WriteString("<u>" + escape(string(e)) + "</u>")
+	case parser.StrikethroughText:
+		_, err = r.buffer.WriteString("~~")
+		if err == nil {
+			err = r.renderElement(e.Text)
+		}
+		if err == nil {
+			_, err = r.buffer.WriteString("~~")
+		}
+	case parser.ColoredText:
+		err = r.renderElement(e.Text)
 	default:
 		panic(
 			errors.New(
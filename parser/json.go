@@ -0,0 +1,299 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// FromJSON reads a Document from the JSON representation written by
+// the json renderer.  Elements are checked against the places the
+// parser would put them, so a block like a verse or an image has to be
+// alone in its paragraph, and only text can go inside another element.
+func FromJSON(fin io.Reader) (Document, error) {
+	d := Document{}
+	if err := json.NewDecoder(fin).Decode(&d); err != nil {
+		return Document{}, err
+	}
+	return d, nil
+}
+
+// jsonElement is the JSON representation of a DocumentElement.  The
+// type tag identifies which of the concrete element types it holds.
+type jsonElement struct {
+	Type       string          `json:"type"`
+	Text       string          `json:"text,omitempty"`
+	Content    *jsonElement    `json:"content,omitempty"`
+	Lines      [][]jsonElement `json:"lines,omitempty"`
+	Path       string          `json:"path,omitempty"`
+	Renderer   string          `json:"renderer,omitempty"`
+	Renderers  []string        `json:"renderers,omitempty"`
+	Paragraphs []Paragraph     `json:"paragraphs,omitempty"`
+}
+
+// MarshalJSON encodes a StoryType using the same names as the @type
+// directive.
+func (t StoryType) MarshalJSON() ([]byte, error) {
+	switch t {
+	case ShortStory:
+		return json.Marshal("shortStory")
+	case Novel:
+		return json.Marshal("novel")
+	}
+	return nil, fmt.Errorf("Invalid story type %d", t)
+}
+
+// UnmarshalJSON decodes a StoryType from the names used by the @type
+// directive.
+func (t *StoryType) UnmarshalJSON(data []byte) error {
+	name := ""
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+
+	switch name {
+	case "shortStory":
+		*t = ShortStory
+	case "novel":
+		*t = Novel
+	default:
+		return fmt.Errorf("Invalid story type %q", name)
+	}
+	return nil
+}
+
+// MarshalJSON encodes a Paragraph, tagging each of its elements with
+// its type.
+func (p Paragraph) MarshalJSON() ([]byte, error) {
+	text := []jsonElement{}
+	for _, e := range p.Text {
+		je, err := elementToJSON(e)
+		if err != nil {
+			return nil, err
+		}
+		text = append(text, je)
+	}
+
+	return json.Marshal(
+		struct {
+			Alignment string `json:",omitempty"`
+			Text      []jsonElement
+		}{p.Alignment.String(), text},
+	)
+}
+
+// UnmarshalJSON decodes a Paragraph, using the type tag on each
+// element to reconstruct the correct concrete type.
+func (p *Paragraph) UnmarshalJSON(data []byte) error {
+	raw := struct {
+		Alignment string
+		Text      []jsonElement
+	}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	p.Alignment = DefaultAlignment
+	if raw.Alignment != "" {
+		alignment, ok := alignments[raw.Alignment]
+		if !ok {
+			return fmt.Errorf("Invalid alignment %q", raw.Alignment)
+		}
+		p.Alignment = alignment
+	}
+
+	p.Text = nil
+	for _, je := range raw.Text {
+		e, err := elementFromJSON(je)
+		if err != nil {
+			return err
+		}
+		if isBlock(e) && len(raw.Text) != 1 {
+			return fmt.Errorf(
+				"A %s element must be alone in its paragraph",
+				je.Type,
+			)
+		}
+		p.Text = append(p.Text, e)
+	}
+	return nil
+}
+
+// isBlock checks whether an element is one the parser only ever puts
+// in a paragraph of its own.
+func isBlock(element DocumentElement) bool {
+	switch element.(type) {
+	case VerseBlock, Image, RawBlock, ConditionalBlock, SpoilerBlock:
+		return true
+	}
+	return false
+}
+
+func elementToJSON(element DocumentElement) (jsonElement, error) {
+	switch e := element.(type) {
+	case PlainText:
+		return jsonElement{Type: "plain", Text: string(e)}, nil
+	case ItalicText:
+		return jsonElement{Type: "italic", Text: string(e)}, nil
+	case BoldText:
+		return jsonElement{Type: "bold", Text: string(e)}, nil
+	case BoldItalicText:
+		return jsonElement{Type: "boldItalic", Text: string(e)}, nil
+	case UnderlineText:
+		return jsonElement{Type: "underline", Text: string(e)}, nil
+	case Footnote:
+		return jsonElement{Type: "footnote", Text: string(e)}, nil
+	case StrikethroughText:
+		content, err := elementToJSON(e.Text)
+		if err != nil {
+			return jsonElement{}, err
+		}
+		return jsonElement{Type: "strikethrough", Content: &content}, nil
+	case ColoredText:
+		content, err := elementToJSON(e.Text)
+		if err != nil {
+			return jsonElement{}, err
+		}
+		return jsonElement{
+			Type:    "color",
+			Text:    e.Color,
+			Content: &content,
+		}, nil
+	case VerseBlock:
+		lines := [][]jsonElement{}
+		for _, l := range e.Lines {
+			line := []jsonElement{}
+			for _, le := range l {
+				je, err := elementToJSON(le)
+				if err != nil {
+					return jsonElement{}, err
+				}
+				line = append(line, je)
+			}
+			lines = append(lines, line)
+		}
+		return jsonElement{Type: "verse", Lines: lines}, nil
+	case Image:
+		return jsonElement{Type: "image", Path: e.Path, Text: e.Caption}, nil
+	case RawBlock:
+		return jsonElement{
+			Type:     "raw",
+			Renderer: e.Renderer,
+			Text:     e.Content,
+		}, nil
+	case ConditionalBlock:
+		je := jsonElement{
+			Type:       "only",
+			Renderers:  e.Renderers,
+			Paragraphs: e.Paragraphs,
+		}
+		if e.Except {
+			je.Type = "except"
+		}
+		return je, nil
+	case SpoilerBlock:
+		return jsonElement{
+			Type:       "spoiler",
+			Text:       e.Title,
+			Paragraphs: e.Paragraphs,
+		}, nil
+	}
+	return jsonElement{}, fmt.Errorf("Can't encode element of type %T", element)
+}
+
+func elementFromJSON(je jsonElement) (DocumentElement, error) {
+	switch je.Type {
+	case "plain":
+		return PlainText(je.Text), nil
+	case "italic":
+		return ItalicText(je.Text), nil
+	case "bold":
+		return BoldText(je.Text), nil
+	case "boldItalic":
+		return BoldItalicText(je.Text), nil
+	case "underline":
+		return UnderlineText(je.Text), nil
+	case "footnote":
+		return Footnote(je.Text), nil
+	case "strikethrough":
+		if je.Content == nil {
+			return nil, errors.New("Missing content for strikethrough text")
+		}
+		content, err := inlineFromJSON(*je.Content, "strikethrough text")
+		if err != nil {
+			return nil, err
+		}
+		return StrikethroughText{Text: content}, nil
+	case "color":
+		if je.Content == nil {
+			return nil, errors.New("Missing content for colored text")
+		}
+		if _, _, _, ok := ColorRGB(je.Text); !ok {
+			return nil, fmt.Errorf("Invalid color %s", je.Text)
+		}
+		content, err := inlineFromJSON(*je.Content, "colored text")
+		if err != nil {
+			return nil, err
+		}
+		return ColoredText{Color: je.Text, Text: content}, nil
+	case "verse":
+		verse := VerseBlock{}
+		for _, l := range je.Lines {
+			line := []DocumentElement{}
+			for _, lje := range l {
+				e, err := inlineFromJSON(lje, "verse")
+				if err != nil {
+					return nil, err
+				}
+				line = append(line, e)
+			}
+			verse.Lines = append(verse.Lines, line)
+		}
+		return verse, nil
+	case "image":
+		return Image{Path: je.Path, Caption: je.Text}, nil
+	case "raw":
+		return RawBlock{Renderer: je.Renderer, Content: je.Text}, nil
+	case "only", "except":
+		return ConditionalBlock{
+			Renderers:  je.Renderers,
+			Except:     je.Type == "except",
+			Paragraphs: je.Paragraphs,
+		}, nil
+	case "spoiler":
+		return SpoilerBlock{Title: je.Text, Paragraphs: je.Paragraphs}, nil
+	}
+	return nil, fmt.Errorf("Unknown element type %q", je.Type)
+}
+
+// inlineFromJSON decodes an element nested inside another one, which
+// has to be text rather than a block.
+func inlineFromJSON(je jsonElement, within string) (DocumentElement, error) {
+	e, err := elementFromJSON(je)
+	if err != nil {
+		return nil, err
+	}
+	if isBlock(e) {
+		return nil, fmt.Errorf("Can't use a %s element in %s", je.Type, within)
+	}
+	return e, nil
+}
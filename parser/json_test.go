@@ -0,0 +1,89 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package parser
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const jsonSource = `@title A Story
+@authorName Someone
+@type novel
+@begin
+@part One
+@chapter The Start
+Some *italic*, **bold**, _underlined_ and ~~struck~~ text.
+
+{color:red}Red{/color} text with a footnote.[^Just a note.]
+
+@verse
+One *line*,
+two lines.
+@endverse
+
+@scene
+@only html
+Just for the web.
+@endonly
+
+@spoiler Ending
+They all lived.
+@endspoiler
+`
+
+func TestJSONRoundTrip(t *testing.T) {
+	d := parse(t, jsonSource)
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	got, err := FromJSON(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("FromJSON: %v", err)
+	}
+	if !reflect.DeepEqual(got, d) {
+		t.Errorf("got %#v, want %#v", got, d)
+	}
+}
+
+func TestJSONInvalidElements(t *testing.T) {
+	verse := `{"type":"verse","lines":[[{"type":"plain","text":"A line"}]]}`
+	tests := []string{
+		`{"type":"plain","text":"hi "},` + verse,
+		`{"type":"strikethrough","content":` + verse + `}`,
+		`{"type":"color","text":"red","content":{"type":"image","path":"a"}}`,
+		`{"type":"verse","lines":[[{"type":"raw","renderer":"html"}]]}`,
+	}
+
+	for _, test := range tests {
+		src := `{"Parts":[{"Chapters":[{"Scenes":[{"Sections":[` +
+			`{"Paragraphs":[{"Text":[` + test + `]}]}]}]}]}]}`
+		d, err := FromJSON(strings.NewReader(src))
+		if err == nil {
+			t.Errorf("%s: decoded without an error", test)
+		}
+		if !reflect.DeepEqual(d, Document{}) {
+			t.Errorf("%s: got %#v, want an empty document", test, d)
+		}
+	}
+}
@@ -21,26 +21,66 @@ package parser
 import (
 	"bufio"
 	"errors"
+	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 	"unicode"
 )
 
 // Document defines a story, both its text and relevant metadata.
+// AfterMatter holds the paragraphs of the story's afterword, if it has
+// one, which come after the last chapter.
 type Document struct {
-	Type       StoryType
-	Title      string
-	ShortTitle string
-	Author     struct {
-		Name             string
-		Byline           string
-		ShortName        string
-		Address          []string
-		PhoneNumber      string
-		EmailAddress     string
-		ProfessionalOrgs []string
-	}
-	Parts []Part
+	Type        StoryType
+	Title       string
+	ShortTitle  string
+	Author      Author
+	CoAuthors   []Author
+	Date        time.Time
+	CoverImage  string
+	Description string
+	Tags        []string
+	Direction   string
+	Language    string
+	HTMLStyle   string
+	Dedication  []string
+	Parts       []Part
+	AfterMatter []Paragraph
+}
+
+// Author holds an author's name and contact information.  A document
+// has a primary author, and may also have any number of co-authors.
+type Author struct {
+	Name             string
+	Byline           string
+	ShortName        string
+	Address          []string
+	PhoneNumber      string
+	EmailAddress     string
+	Website          string
+	SocialLinks      []string
+	ProfessionalOrgs []string
+}
+
+// SoftHyphen is written into the text wherever the story marks a
+// place a word may be hyphenated with \-.  Renderers that can't break
+// words themselves should remove it.
+const SoftHyphen = '\u00ad'
+
+// NonBreakingSpace is written into the text wherever the story has an
+// escaped space, as in Mr.\ Smith, or a non-breaking space of its own.
+// Unlike other whitespace it's kept as it is rather than collapsed, and
+// renderers shouldn't break lines at it.
+const NonBreakingSpace = '\u00a0'
+
+// dateLayouts lists the formats accepted by the @date directive.
+var dateLayouts = []string{
+	"2006-01-02",
+	"January 2, 2006",
+	"2 January 2006",
 }
 
 // Part defines a part of the document, which may or may not have a
@@ -66,14 +106,30 @@ type Chapter struct {
 	Anonymous bool
 	Prologue  bool
 	Number    int
+	Epigraph  *Epigraph
 
 	Scenes []Scene
 }
 
 // Scene defines a single scene in the text, which may or may not end
-// with a hard scene-break.
+// with a hard scene-break.  The break may have a label, such as "Three
+// Days Later", to show along with it.  A stray @scene at the end of a
+// chapter still marks its last scene as ending with a break, but
+// renderers only show breaks between scenes, never after the last.
 type Scene struct {
 	EndsWithSceneBreak bool
+	BreakLabel         string
+
+	Sections []Section
+}
+
+// Section defines a subdivision of a scene, which may or may not have
+// a title, and may also be anonymous (meaning that the document hasn't
+// explicitly declared the beginning of a section and no title should
+// be emitted).
+type Section struct {
+	Title     string
+	Anonymous bool
 
 	Paragraphs []Paragraph
 }
@@ -81,7 +137,33 @@ type Scene struct {
 // Paragraph defines a single paragraph of text, composed of
 // potentially multiple sections of text with varying formatting.
 type Paragraph struct {
-	Text []DocumentElement
+	Alignment Alignment
+	Text      []DocumentElement
+}
+
+// Alignment defines how the lines of a paragraph are lined up.
+type Alignment int
+
+const (
+	// DefaultAlignment leaves a paragraph formatted like any other.
+	DefaultAlignment Alignment = iota
+	// LeftAlignment lines a paragraph up on the left, with no indent.
+	LeftAlignment
+	// CenterAlignment centers each line of a paragraph.
+	CenterAlignment
+	// RightAlignment lines a paragraph up on the right.
+	RightAlignment
+)
+
+// String returns the name of the directive for the alignment, or an
+// empty string for the default alignment.
+func (a Alignment) String() string {
+	for name, alignment := range alignments {
+		if a == alignment {
+			return name
+		}
+	}
+	return ""
 }
 
 // StoryType defines the type of a document.
@@ -102,8 +184,10 @@ type DocumentElement interface{}
 // ParagraphBreak is just a linebreak between paragraphs.
 type ParagraphBreak bool
 
-// SceneBreak is a break between scenes.
-type SceneBreak bool
+// SceneBreak is a break between scenes, with an optional label.
+type SceneBreak struct {
+	Label string
+}
 
 // PrologueBreak is a break in the text for a prologue.  It may have a
 // title or be empty.
@@ -117,6 +201,70 @@ type PartBreak string
 // have a title or be empty.
 type ChapterBreak string
 
+// SectionBreak is a break for a new section within a scene.  It may
+// have a title or be empty.
+type SectionBreak string
+
+// Afterword is a block of paragraphs to be placed after the end of the
+// story.  It never becomes part of a chapter.
+type Afterword []Paragraph
+
+// ConditionalBlock is a block of paragraphs meant only for some
+// renderers.  It's included by the listed renderers, or by every other
+// renderer when Except is set.  A ConditionalBlock is always the only
+// element in its paragraph.
+type ConditionalBlock struct {
+	Renderers  []string
+	Except     bool
+	Paragraphs []Paragraph
+}
+
+// Includes checks whether the block should be rendered by the named
+// renderer.
+func (c ConditionalBlock) Includes(renderer string) bool {
+	listed := false
+	for _, r := range c.Renderers {
+		if r == renderer {
+			listed = true
+		}
+	}
+	return listed != c.Except
+}
+
+// SpoilerBlock is a block of paragraphs to be hidden until the reader
+// chooses to see them, with an optional title saying what's hidden.
+// Renderers that can't hide text show it as ordinary paragraphs.  A
+// SpoilerBlock is always the only element in its paragraph.
+type SpoilerBlock struct {
+	Title      string
+	Paragraphs []Paragraph
+}
+
+// blockEnd marks the @end directive closing a block, such as
+// @endafterword, and only ever appears while that block is being read.
+// It holds the name of the block's opening directive.
+type blockEnd string
+
+// included holds the text of a file pulled in with @include, which is
+// spliced into the story in place of the directive.
+type included []DocumentElement
+
+// blockDirectives lists the directives whose blocks are read by
+// lexBlock, and so can't be nested in one another.
+var blockDirectives = map[string]bool{
+	"afterword": true,
+	"only":      true,
+	"except":    true,
+	"spoiler":   true,
+}
+
+// Epigraph is a short quotation at the beginning of a chapter, with an
+// optional attribution.
+type Epigraph struct {
+	Text        string
+	Attribution string
+}
+
 // PlainText is simple unformatted text.
 type PlainText string
 
@@ -129,42 +277,241 @@ type BoldText string
 // BoldItalicText will be rendered as both bold and italic.
 type BoldItalicText string
 
+// Footnote is a note attached to the preceding text.
+type Footnote string
+
+// UnderlineText will be rendered as underlined.
+type UnderlineText string
+
+// StrikethroughText will be rendered with a line through it.  It
+// wraps one of the other text elements, so struck-through text may
+// also be bold, italic, etc.
+type StrikethroughText struct {
+	Text DocumentElement
+}
+
+// ColoredText will be rendered in the given color, where the renderer
+// supports it.  Like StrikethroughText, it wraps one of the other text
+// elements.  The color is either one of the names in ColorNames or a
+// hex value like #ff8800, and is always lower case.
+type ColoredText struct {
+	Color string
+	Text  DocumentElement
+}
+
+// Image is an illustration placed in the text, with an optional
+// caption.  An Image is always the only element in its paragraph.
+type Image struct {
+	Path    string
+	Caption string
+}
+
+// VerseBlock is a passage of poetry or song lyrics whose line breaks
+// are kept as written.  Each line is made up of formatted text
+// elements, just like a paragraph.  A VerseBlock is always the only
+// element in its paragraph.
+type VerseBlock struct {
+	Lines [][]DocumentElement
+}
+
+// RawBlock is a snippet written for one particular renderer, such as
+// a bit of HTML, which that renderer passes through exactly as written
+// and every other renderer leaves out.  A RawBlock is always the only
+// element in its paragraph.
+type RawBlock struct {
+	Renderer string
+	Content  string
+}
+
+// ParseError describes a problem with the syntax of a document.
+// Errors reading the document are returned as-is rather than wrapped
+// in a ParseError, so callers can tell the two apart with errors.As.
+// File names the file the error is in, if the story was read with
+// ParseFile or the error is in a file pulled in with @include.
+type ParseError struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	message := e.Message
+	if e.Line != 0 {
+		message = fmt.Sprintf("line %d: %s", e.Line, message)
+	}
+	if e.File != "" {
+		message = e.File + ": " + message
+	}
+	return message
+}
+
+func parseErrorf(format string, args ...interface{}) error {
+	return &ParseError{Message: fmt.Sprintf(format, args...)}
+}
+
 // Parse reads a document from a text file and returns a parsed
 // Document object if there aren't any errors.
 func Parse(rawFIN io.Reader) (d Document, err error) {
-	fin := bufio.NewReader(rawFIN)
+	return parseAll(newLineReader(rawFIN))
+}
+
+// ParseFile reads a document from the file at the given path.  Unlike
+// Parse, it knows where the story lives, so the paths given to
+// @include, @image and @cover are taken relative to the story's own
+// directory rather than the current one, and errors name the file.
+func ParseFile(path string) (d Document, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+
+	fin := newLineReader(file)
+	fin.path, fin.includes = path, []string{absPath}
+	return parseAll(fin)
+}
+
+func parseAll(fin *lineReader) (d Document, err error) {
+	var parts []Part
+	d, err = parseStream(fin, func(p Part) error {
+		parts = append(parts, p)
+		return nil
+	})
+	d.Parts = parts
+	return
+}
+
+// ParseStream reads a document from a text file, passing each part of
+// the story to emit as soon as it has been read in full, so that the
+// whole story never has to be held in memory at once.  The returned
+// Document holds the story's metadata, but no parts.  If emit returns
+// an error, parsing stops and that error is returned.
+func ParseStream(
+	rawFIN io.Reader,
+	emit func(Part) error,
+) (d Document, err error) {
+	return parseStream(newLineReader(rawFIN), emit)
+}
+
+func parseStream(
+	fin *lineReader,
+	emit func(Part) error,
+) (d Document, err error) {
+	// Errors that don't already point somewhere more specific are
+	// reported at the line the parser stopped on.
+	defer func() {
+		var parseErr *ParseError
+		if errors.As(err, &parseErr) && parseErr.File == "" {
+			parseErr.File = fin.path
+			if parseErr.Line == 0 {
+				parseErr.Line = fin.line
+			}
+		}
+	}()
 
 	d, err = lexMetadata(fin)
 	if err != nil {
 		return
 	}
 
+	partNumber := 0
+	emitPart := func(p Part) error {
+		if !p.Anonymous {
+			partNumber++
+		}
+		p.Number = partNumber
+		return emit(p)
+	}
+
 	text := []DocumentElement{}
 	for {
 		es := []DocumentElement{}
 		es, err = lexParagraphOrDirective(fin)
+		if err != nil && err != io.EOF {
+			return
+		}
 
-		if err == io.EOF {
-			text = append(text, es...)
-			err = nil
+		lexErr := err
+		for _, e := range es {
+			// The afterword is kept out of the story's text, so it
+			// doesn't count toward any chapter.
+			if afterword, ok := e.(Afterword); ok {
+				d.AfterMatter = append(d.AfterMatter, afterword...)
+				continue
+			}
+			if end, ok := e.(blockEnd); ok {
+				err = parseErrorf("@end%s without @%s", end, end)
+				return
+			}
 
-			d.Parts = parseText(text)
-			return
+			if _, ok := e.(Epigraph); ok && !startsChapter(text) {
+				err = parseErrorf(
+					"Epigraphs may only appear at the beginning of a chapter",
+				)
+				return
+			}
+
+			// A new part means the one before it is finished, so it
+			// can be parsed and sent off.  parsePart stops at the new
+			// part break and hands it back to start the next part.
+			if _, ok := e.(PartBreak); ok && len(text) != 0 {
+				var p Part
+				p, text = parsePart(append(text, e))
+				if err = emitPart(p); err != nil {
+					return
+				}
+				continue
+			}
+			text = append(text, e)
 		}
-		if err != nil {
+
+		if lexErr == io.EOF {
+			var p Part
+			for len(text) != 0 {
+				p, text = parsePart(text)
+				if err = emitPart(p); err != nil {
+					return
+				}
+			}
+			err = nil
 			return
 		}
+	}
+}
 
-		text = append(text, es...)
+// startsChapter checks whether an element appended to the given text
+// would be at the very beginning of a chapter.
+func startsChapter(text []DocumentElement) bool {
+	if len(text) == 0 {
+		return true
 	}
 
-	return
+	switch text[len(text)-1].(type) {
+	case PrologueBreak, ChapterBreak, PartBreak:
+		return true
+	}
+	return false
 }
 
-func lexMetadata(fin *bufio.Reader) (d Document, err error) {
+func lexMetadata(fin *lineReader) (d Document, err error) {
 	name, args := "", []string{}
+	author := &d.Author
 	for name != "begin" {
 		name, args, err = lexMetadataDirective(fin)
+		if err == io.EOF && name != "begin" {
+			err = parseErrorf("Reached end of file before @begin directive")
+			return
+		}
+		// A story may end right after its @begin directive, in which
+		// case it's simply empty.
+		if err == io.EOF {
+			err = nil
+		}
 		if err != nil {
 			return
 		}
@@ -175,7 +522,7 @@ func lexMetadata(fin *bufio.Reader) (d Document, err error) {
 
 		case "type":
 			if len(args) != 1 {
-				err = errors.New("Missing type")
+				err = parseErrorf("Missing type")
 				return
 			}
 
@@ -185,78 +532,167 @@ func lexMetadata(fin *bufio.Reader) (d Document, err error) {
 			case "novel":
 				d.Type = Novel
 			default:
-				err = errors.New("Invalid story type")
+				err = parseErrorf("Invalid story type")
 				return
 			}
 
 		case "title":
 			if len(args) != 1 {
-				err = errors.New("Missing title")
+				err = parseErrorf("Missing title")
 				return
 			}
 			d.Title = args[0]
 
 		case "shortTitle":
 			if len(args) != 1 {
-				err = errors.New("Missing short title")
+				err = parseErrorf("Missing short title")
 				return
 			}
 			d.ShortTitle = args[0]
 
+		case "coauthor":
+			if len(args) != 1 {
+				err = parseErrorf("Missing co-author byline")
+				return
+			}
+			// Any author directives after this one describe the
+			// co-author rather than the primary author.
+			d.CoAuthors = append(d.CoAuthors, Author{Byline: args[0]})
+			author = &d.CoAuthors[len(d.CoAuthors)-1]
+
 		case "authorName":
 			if len(args) != 1 {
-				err = errors.New("Missing author name")
+				err = parseErrorf("Missing author name")
 				return
 			}
-			d.Author.Name = args[0]
+			author.Name = args[0]
 
 		case "authorShortName":
 			if len(args) != 1 {
-				err = errors.New("Missing author short name")
+				err = parseErrorf("Missing author short name")
 				return
 			}
-			d.Author.ShortName = args[0]
+			author.ShortName = args[0]
 
 		case "authorByline":
 			if len(args) != 1 {
-				err = errors.New("Missing author byline")
+				err = parseErrorf("Missing author byline")
 				return
 			}
-			d.Author.Byline = args[0]
+			author.Byline = args[0]
 
 		case "authorAddress":
 			if len(args) < 1 {
-				err = errors.New("Missing author address")
+				err = parseErrorf("Missing author address")
 				return
 			}
-			d.Author.Address = args
+			author.Address = args
 
 		case "authorPhoneNumber":
 			if len(args) != 1 {
-				err = errors.New("Missing author phone number")
+				err = parseErrorf("Missing author phone number")
 				return
 			}
-			d.Author.PhoneNumber = args[0]
+			author.PhoneNumber = args[0]
 
 		case "authorEmail":
 			if len(args) != 1 {
-				err = errors.New("Missing author email")
+				err = parseErrorf("Missing author email")
+				return
+			}
+			author.EmailAddress = args[0]
+
+		case "authorWebsite":
+			if len(args) != 1 {
+				err = parseErrorf("Missing author website")
+				return
+			}
+			author.Website = strings.TrimSpace(args[0])
+
+		case "authorSocial":
+			if len(args) < 1 {
+				err = parseErrorf("Missing author social link")
 				return
 			}
-			d.Author.EmailAddress = args[0]
+			// Unlike the other author directives, this one may be
+			// given more than once, with a link each time.
+			author.SocialLinks = append(author.SocialLinks, args...)
 
 		case "authorOrgs":
 			if len(args) < 1 {
-				err = errors.New("Missing author organizations")
+				err = parseErrorf("Missing author organizations")
+				return
+			}
+			author.ProfessionalOrgs = args
+
+		case "date":
+			if len(args) != 1 {
+				err = parseErrorf("Missing date")
+				return
+			}
+			d.Date, err = parseDate(strings.TrimSpace(args[0]))
+			if err != nil {
+				return
+			}
+
+		case "cover":
+			if len(args) != 1 {
+				err = parseErrorf("Missing cover image")
+				return
+			}
+			d.CoverImage = fin.resolve(strings.TrimSpace(args[0]))
+
+		case "dedication":
+			if len(args) < 1 {
+				err = parseErrorf("Missing dedication")
+				return
+			}
+			d.Dedication = args
+
+		case "description":
+			if len(args) < 1 {
+				err = parseErrorf("Missing description")
+				return
+			}
+			d.Description = strings.Join(args, " ")
+
+		case "tags":
+			if len(args) < 1 {
+				err = parseErrorf("Missing tags")
+				return
+			}
+			d.Tags = parseTags(args)
+
+		case "direction":
+			if len(args) != 1 {
+				err = parseErrorf("Missing direction")
+				return
+			}
+			d.Direction = strings.TrimSpace(args[0])
+			if d.Direction != "ltr" && d.Direction != "rtl" {
+				err = parseErrorf("Invalid direction %s", d.Direction)
+				return
+			}
+
+		case "language":
+			if len(args) != 1 {
+				err = parseErrorf("Missing language")
+				return
+			}
+			d.Language = strings.TrimSpace(args[0])
+
+		case "htmlStyle":
+			if len(args) < 1 {
+				err = parseErrorf("Missing HTML style")
 				return
 			}
-			d.Author.ProfessionalOrgs = args
+			d.HTMLStyle = strings.Join(args, "\n")
 
 		case "begin":
 			break
 
 		default:
-			err = errors.New("Unrecognized directive")
+			err = parseErrorf("Unrecognized directive")
 			return
 		}
 	}
@@ -264,8 +700,36 @@ func lexMetadata(fin *bufio.Reader) (d Document, err error) {
 	return
 }
 
+// parseTags splits the lines of a @tags directive into separate tags.
+// Tags may be separated by commas or put on lines of their own, so a
+// single tag can have spaces in it, as in "science fiction".
+func parseTags(args []string) []string {
+	tags := []string{}
+	for _, arg := range args {
+		for _, tag := range strings.Split(arg, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+func parseDate(text string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if date, err := time.Parse(layout, text); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, parseErrorf(
+		"Invalid date %q, expected a date like %s",
+		text,
+		strings.Join(dateLayouts, " or "),
+	)
+}
+
 func lexParagraphOrDirective(
-	fin *bufio.Reader,
+	fin *lineReader,
 ) (es []DocumentElement, err error) {
 	err = eatWhitespace(fin)
 	if err != nil {
@@ -285,10 +749,32 @@ func lexParagraphOrDirective(
 		if err != nil {
 			return
 		}
+		if text, ok := e.(included); ok {
+			es = text
+			return
+		}
 		if e != nil {
 			es = []DocumentElement{e}
 		}
+		// Verse, images, raw and conditional blocks always stand as
+		// paragraphs of their own.
+		switch e.(type) {
+		case VerseBlock, Image, RawBlock, ConditionalBlock, SpoilerBlock:
+			es = append(es, ParagraphBreak(true))
+		}
+
+		// Alignment applies to the paragraph right after it.
+		if _, ok := e.(Alignment); ok {
+			var paragraph []DocumentElement
+			paragraph, err = lexAlignedParagraph(fin)
+			es = append(es, paragraph...)
+		}
+	} else if r == '%' {
+		err = lexComment(fin)
 	} else {
+		// A paragraph that starts with an escaped '@', as in
+		// \@username, ends up here rather than being taken for a
+		// directive, and lexParagraph keeps the '@' as plain text.
 		fin.UnreadRune()
 		es, err = lexParagraph(fin)
 	}
@@ -300,7 +786,7 @@ func lexParagraphOrDirective(
 // terminated by the beginning '@' of another directive (except for
 // @begin), and their arguments may span multiple lines.
 func lexMetadataDirective(
-	fin *bufio.Reader,
+	fin *lineReader,
 ) (name string, args []string, err error) {
 	err = eatWhitespace(fin)
 	if err != nil {
@@ -309,7 +795,7 @@ func lexMetadataDirective(
 
 	r, _, err := fin.ReadRune()
 	if r != '@' {
-		err = errors.New("Expected directive")
+		err = parseErrorf("Expected directive")
 		return
 	}
 
@@ -347,11 +833,12 @@ func lexMetadataDirective(
 
 // A regular directive in the text may only have a single,
 // newline-terminated argument.
-func lexDirective(fin *bufio.Reader) (e DocumentElement, err error) {
+func lexDirective(fin *lineReader) (e DocumentElement, err error) {
+	line := fin.line
 	r := '\000'
 	r, _, err = fin.ReadRune()
 	if r != '@' {
-		err = errors.New("Missing '@' in directive")
+		err = parseErrorf("Missing '@' in directive")
 	}
 	if err != nil {
 		return
@@ -359,6 +846,11 @@ func lexDirective(fin *bufio.Reader) (e DocumentElement, err error) {
 
 	name := ""
 	name, err = readWord(fin)
+	// A directive on the very last line of the file, like the
+	// @endafterword closing a story, doesn't need a newline after it.
+	if err == io.EOF && name != "" {
+		err = nil
+	}
 	if err != nil {
 		return
 	}
@@ -368,19 +860,43 @@ func lexDirective(fin *bufio.Reader) (e DocumentElement, err error) {
 		"part":     true,
 		"prologue": true,
 		"note":     true,
+		"epigraph": true,
+		"section":  true,
+		"image":    true,
+		"raw":      true,
+		"scene":    true,
+		"only":     true,
+		"spoiler":  true,
+		"except":   true,
+		"include":  true,
 	}
 
-	if name == "scene" {
-		e = SceneBreak(true)
+	if name == "verse" {
+		e, err = lexVerse(fin)
+		return
+	} else if name == "afterword" {
+		e, err = lexAfterword(fin, line)
+		return
+	} else if strings.HasPrefix(name, "end") && blockDirectives[name[3:]] {
+		e = blockEnd(name[3:])
+		return
+	} else if alignment, ok := alignments[name]; ok {
+		e = alignment
 		return
 	} else if _, ok := argDirectives[name]; !ok {
-		err = errors.New("Invalid directive")
+		err = parseErrorf("Invalid directive")
 		return
 	}
 
+	// Like the name, the argument may run right up to the end of the
+	// file.
 	rawArg := []rune{}
 	for {
 		r, _, err = fin.ReadRune()
+		if err == io.EOF {
+			err = nil
+			break
+		}
 		if err != nil {
 			return
 		}
@@ -391,117 +907,750 @@ func lexDirective(fin *bufio.Reader) (e DocumentElement, err error) {
 	}
 	arg := strings.TrimSpace(string(rawArg))
 
-	if name == "chapter" {
+	if name == "scene" {
+		e = SceneBreak{Label: arg}
+	} else if name == "chapter" {
 		e = ChapterBreak(arg)
 	} else if name == "part" {
 		e = PartBreak(arg)
 	} else if name == "prologue" {
 		e = PrologueBreak(arg)
+	} else if name == "section" {
+		e = SectionBreak(arg)
+	} else if name == "epigraph" {
+		e, err = lexEpigraph(fin, arg)
+	} else if name == "image" {
+		e, err = parseImage(fin, arg)
+	} else if name == "raw" {
+		e, err = lexRaw(fin, arg)
+	} else if name == "only" || name == "except" {
+		e, err = lexConditional(fin, line, name, arg)
+	} else if name == "spoiler" {
+		e, err = lexSpoiler(fin, line, arg)
+	} else if name == "include" {
+		e, err = lexInclude(fin, line, arg)
 	}
 
 	return
 }
 
-func lexParagraph(fin *bufio.Reader) (es []DocumentElement, err error) {
-	buf := []rune{}
-	bold := false
-	italic := false
-
-	for {
-		r := '\000'
-		r, _, err = fin.ReadRune()
-		if err != nil {
-			return
-		}
-
-		if r == '\n' {
-			r, _, err = fin.ReadRune()
-			if err != nil {
-				if err == io.EOF {
-					if len(buf) != 0 {
-						es = append(es, formatText(buf, bold, italic))
-					}
-				}
-				return
-			}
+// An included file holds nothing but story text, which is read just as
+// if it had been pasted in place of the @include directive on the given
+// line.  Relative paths are taken from the directory of the including
+// file, or the current directory if we aren't reading from a file.
+func lexInclude(fin *lineReader, line int, arg string) (e included, err error) {
+	if arg == "" {
+		err = &ParseError{Line: line, Message: "Missing path for @include"}
+		return
+	}
 
-			fin.UnreadRune()
-			if r == '\n' || r == '@' {
-				if len(buf) != 0 {
-					es = append(es, formatText(buf, bold, italic))
-				}
-				break
-			} else {
-				buf = addWhitespace(buf)
-			}
-		} else if unicode.IsSpace(r) {
-			buf = addWhitespace(buf)
-		} else if r == '\\' {
-			r, _, err = fin.ReadRune()
-			if err != nil {
-				return
-			}
-			buf = append(buf, r)
-		} else if r == '*' {
-			flipItalic := true
-			flipBold := false
+	path := fin.resolve(arg)
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
 
-			r, _, err = fin.ReadRune()
-			if err != nil {
-				return
+	chain := append(append([]string{}, fin.includes...), absPath)
+	for _, p := range fin.includes {
+		if p == absPath {
+			err = &ParseError{
+				Line:    line,
+				Message: "Include cycle: " + strings.Join(chain, " -> "),
 			}
+			return
+		}
+	}
 
-			if r == '*' {
-				flipBold = true
-				flipItalic = false
-
-				r, _, err = fin.ReadRune()
-				if err != nil {
-					return
-				}
-
-				if r == '*' {
-					flipItalic = true
-				} else {
-					fin.UnreadRune()
-				}
-			} else {
-				fin.UnreadRune()
+	file, err := os.Open(path)
+	if err != nil {
+		err = &ParseError{
+			Line:    line,
+			Message: fmt.Sprintf("Can't read included file %s", arg),
+		}
+		return
+	}
+	defer file.Close()
+
+	inner := newLineReader(file)
+	inner.path, inner.includes = path, chain
+
+	// Errors in the included file are reported against that file,
+	// unless they come from another file it includes in turn.
+	defer func() {
+		var parseErr *ParseError
+		if errors.As(err, &parseErr) && parseErr.File == "" {
+			parseErr.File = path
+			if parseErr.Line == 0 {
+				parseErr.Line = inner.line
 			}
+		}
+	}()
 
-			es = append(es, formatText(buf, bold, italic))
-			buf = []rune{}
+	for {
+		var es []DocumentElement
+		es, err = lexParagraphOrDirective(inner)
+		if err != nil && err != io.EOF {
+			return
+		}
+		e = append(e, es...)
 
-			if flipBold {
-				bold = !bold
-			}
-			if flipItalic {
-				italic = !italic
-			}
-		} else {
-			buf = append(buf, r)
+		if err == io.EOF {
+			err = nil
+			break
 		}
 	}
-
-	es = append(es, ParagraphBreak(true))
 	return
 }
 
-func parseText(text []DocumentElement) (ps []Part) {
-	var p Part
-	for partNumber := 0; len(text) != 0; {
-		p, text = parsePart(text)
+// An image's path is the first word after the directive, and anything
+// after that is its caption.
+func parseImage(fin *lineReader, arg string) (e Image, err error) {
+	fields := strings.Fields(arg)
+	if len(fields) == 0 {
+		err = parseErrorf("Missing image path")
+		return
+	}
 
-		if !p.Anonymous {
-			partNumber++
+	e.Path = fin.resolve(fields[0])
+	e.Caption = strings.TrimSpace(strings.TrimPrefix(arg, fields[0]))
+	return
+}
+
+var alignments = map[string]Alignment{
+	"left":   LeftAlignment,
+	"center": CenterAlignment,
+	"right":  RightAlignment,
+}
+
+// The paragraph after an alignment directive may start on the same
+// line as the directive or on the next one, but it has to be a
+// paragraph and not another directive.
+func lexAlignedParagraph(fin *lineReader) (es []DocumentElement, err error) {
+	missing := &ParseError{
+		Line:    fin.line,
+		Message: "Missing paragraph after alignment directive",
+	}
+
+	err = eatWhitespace(fin)
+	if err == io.EOF {
+		err = missing
+	}
+	if err != nil {
+		return
+	}
+
+	r := '\000'
+	r, _, err = fin.ReadRune()
+	if err != nil {
+		return
+	}
+	fin.UnreadRune()
+	if r == '@' {
+		err = missing
+		return
+	}
+
+	return lexParagraph(fin)
+}
+
+// Verse runs from the line after the @verse directive up to a line
+// holding only @endverse.  Each line is formatted like a paragraph of
+// its own, so styles can't carry over from one line to the next.
+func lexVerse(fin *lineReader) (e VerseBlock, err error) {
+	if _, err = readPlainText(fin); err != nil {
+		return
+	}
+
+	for {
+		line := fin.line
+		text := ""
+		text, err = readPlainText(fin)
+		if err == io.EOF {
+			err = parseErrorf("Unterminated verse")
+		}
+		if err != nil {
+			return
+		}
+
+		text = strings.TrimSpace(text)
+		if text == "@endverse" {
+			return
+		}
+		// Lines that are nothing but a comment are left out entirely,
+		// rather than leaving a blank line in the verse.
+		if strings.HasPrefix(text, "%") {
+			continue
+		}
+
+		lineFIN := &lineReader{
+			Reader: bufio.NewReader(strings.NewReader(text + "\n")),
+			line:   line,
+		}
+
+		var es []DocumentElement
+		es, err = lexParagraph(lineFIN)
+		if err != nil && err != io.EOF {
+			return
+		}
+		err = nil
+
+		// Each line is lexed as a paragraph of its own, but the break
+		// that finishes it off isn't part of the verse.
+		if n := len(es); n != 0 {
+			if _, ok := es[n-1].(ParagraphBreak); ok {
+				es = es[:n-1]
+			}
 		}
-		p.Number = partNumber
 
-		ps = append(ps, p)
+		e.Lines = append(e.Lines, es)
+	}
+}
+
+// A raw block runs from the line after the @raw directive up to a line
+// holding only @endraw, and is kept exactly as written, without any
+// formatting or escaping.
+func lexRaw(fin *lineReader, renderer string) (e RawBlock, err error) {
+	if renderer == "" {
+		err = parseErrorf("Missing renderer name for raw block")
+		return
+	}
+	e.Renderer = renderer
+
+	lines := []string{}
+	for {
+		line := ""
+		line, err = readPlainText(fin)
+		if err == io.EOF {
+			err = parseErrorf("Unterminated raw block")
+		}
+		if err != nil {
+			return
+		}
+
+		if strings.TrimSpace(line) == "@endraw" {
+			break
+		}
+		lines = append(lines, line)
+	}
+
+	e.Content = strings.Join(lines, "\n")
+	return
+}
+
+// An afterword runs from the @afterword directive up to the matching
+// @endafterword, and may only hold paragraphs, verse and images.
+func lexAfterword(fin *lineReader, line int) (e Afterword, err error) {
+	e, err = lexBlock(fin, line, "afterword")
+	return
+}
+
+// A conditional block runs from the @only or @except directive up to
+// the matching @endonly or @endexcept.  The directive is followed by a
+// comma-separated list of renderer names.  Since the whole point is to
+// pick out plain paragraphs, it can't hold verse or raw blocks either.
+func lexConditional(
+	fin *lineReader,
+	line int,
+	name, arg string,
+) (e ConditionalBlock, err error) {
+	for _, r := range strings.Split(arg, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			e.Renderers = append(e.Renderers, r)
+		}
+	}
+	if len(e.Renderers) == 0 {
+		err = parseErrorf("Missing renderer names for @%s block", name)
+		return
+	}
+	e.Except = name == "except"
+
+	e.Paragraphs, err = lexBlock(fin, line, name)
+	if err != nil {
+		return
+	}
+
+	for _, p := range e.Paragraphs {
+		inner := ""
+		if _, ok := p.Verse(); ok {
+			inner = "verse"
+		} else if _, ok := p.Raw(); ok {
+			inner = "raw"
+		}
+		if inner != "" {
+			err = parseErrorf(
+				"@%s blocks can't be nested inside @%s blocks",
+				inner,
+				name,
+			)
+			return
+		}
+	}
+	return
+}
+
+// A spoiler runs from the @spoiler directive, which may be followed by
+// a title, up to the matching @endspoiler.  Raw blocks are only meant
+// for a single renderer, so they can't be hidden in one.
+func lexSpoiler(
+	fin *lineReader,
+	line int,
+	arg string,
+) (e SpoilerBlock, err error) {
+	e.Title = arg
+	e.Paragraphs, err = lexBlock(fin, line, "spoiler")
+	if err != nil {
+		return
+	}
+
+	for _, p := range e.Paragraphs {
+		if _, ok := p.Raw(); ok {
+			err = parseErrorf(
+				"@raw blocks can't be nested inside @spoiler blocks",
+			)
+			return
+		}
 	}
 	return
 }
 
+// lexBlock reads the paragraphs of a block directive, which starts on
+// the given line, up to its matching @end directive.  Blocks may only
+// hold paragraphs, and can't be nested in one another.  A block that's
+// never closed is reported at the line it starts on, since the end of
+// the file isn't much help to the author.
+func lexBlock(
+	fin *lineReader,
+	line int,
+	name string,
+) (ps []Paragraph, err error) {
+	text := []DocumentElement{}
+	for done := false; !done; {
+		var es []DocumentElement
+		es, err = lexParagraphOrDirective(fin)
+		if err == io.EOF {
+			err = &ParseError{
+				Line:    line,
+				Message: fmt.Sprintf("Unterminated @%s block", name),
+			}
+		}
+		if err != nil {
+			return
+		}
+
+		for _, el := range es {
+			inner := ""
+			switch el := el.(type) {
+			case blockEnd:
+				if string(el) != name {
+					err = parseErrorf("@end%s without @%s", el, el)
+					return
+				}
+				done = true
+				continue
+			case SceneBreak, SectionBreak, PrologueBreak, ChapterBreak,
+				PartBreak, Epigraph:
+				err = parseErrorf(
+					"Only paragraphs may appear in @%s blocks",
+					name,
+				)
+				return
+			case Afterword:
+				inner = "afterword"
+			case ConditionalBlock:
+				inner = "only"
+				if el.Except {
+					inner = "except"
+				}
+			case SpoilerBlock:
+				inner = "spoiler"
+			}
+			if inner != "" {
+				err = parseErrorf(
+					"@%s blocks can't be nested inside @%s blocks",
+					inner,
+					name,
+				)
+				return
+			}
+			text = append(text, el)
+		}
+	}
+
+	var p Paragraph
+	for len(text) != 0 {
+		p, text = parseParagraph(text)
+		if len(p.Text) != 0 {
+			ps = append(ps, p)
+		}
+	}
+	return
+}
+
+// An epigraph's attribution, if it has one, is on the line immediately
+// following the directive.
+func lexEpigraph(fin *lineReader, text string) (e Epigraph, err error) {
+	e.Text = text
+
+	r := '\000'
+	r, _, err = fin.ReadRune()
+	if err == io.EOF {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	fin.UnreadRune()
+	if r == '\n' || r == '@' {
+		return
+	}
+
+	attribution := ""
+	attribution, err = readPlainText(fin)
+	if err == io.EOF {
+		err = nil
+	}
+	e.Attribution = strings.TrimSpace(attribution)
+	return
+}
+
+func lexParagraph(fin *lineReader) (es []DocumentElement, err error) {
+	buf := []rune{}
+	style := textStyle{}
+
+	// flush finishes off the text read so far in the current style.
+	// Styles can change with no text in between, as when a bold span
+	// ends right where an italic one does, and those empty runs are
+	// simply dropped.
+	flush := func() {
+		if len(buf) != 0 {
+			es = append(es, formatText(buf, style))
+		}
+		buf = []rune{}
+	}
+
+	// Styles have to be closed in the same paragraph they're opened
+	// in, so we track the line each one was opened on to point the
+	// author at any that are left open.
+	opened := map[string]int{}
+	mark := func(on bool, name string) {
+		if on {
+			opened[name] = fin.line
+		} else {
+			delete(opened, name)
+		}
+	}
+	defer func() {
+		// The last paragraph in the file may not be followed by a
+		// blank line, or even a newline, so whatever's been read of it
+		// is finished off here.
+		if err == io.EOF {
+			flush()
+			if len(es) != 0 {
+				es = append(es, ParagraphBreak(true))
+			}
+		}
+		if err == nil || err == io.EOF {
+			if unclosed := unclosedStyle(opened); unclosed != nil {
+				err = unclosed
+			}
+		}
+	}()
+
+	// follows checks whether the next rune is want, and consumes it if
+	// so.  Running into the end of the input just means it doesn't
+	// match, and the next read at the top of the loop will find it.
+	follows := func(want rune) (bool, error) {
+		r, _, err := fin.ReadRune()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if r != want {
+			return false, fin.UnreadRune()
+		}
+		return true, nil
+	}
+
+	// prev is the rune read before this one, so we can tell whether a
+	// '%' starts a comment or is just a percent sign, as in "50%", and
+	// whether an '_' starts underlining or sits inside a word, as in
+	// snake_case.
+	prev := '\n'
+	for {
+		r := '\000'
+		r, _, err = fin.ReadRune()
+		if err != nil {
+			return
+		}
+		before := prev
+		prev = r
+
+		if r == '\n' {
+			r, _, err = fin.ReadRune()
+			if err != nil {
+				return
+			}
+
+			fin.UnreadRune()
+			if r == '\n' || r == '@' {
+				flush()
+				break
+			} else {
+				buf = addWhitespace(buf)
+			}
+		} else if unicode.IsSpace(r) && r != NonBreakingSpace {
+			buf = addWhitespace(buf)
+		} else if r == '\\' {
+			r, _, err = fin.ReadRune()
+			if err == io.EOF {
+				// There's nothing left to escape, so the backslash is
+				// kept as it was written.
+				buf = append(buf, '\\')
+				return
+			}
+			if err != nil {
+				return
+			}
+			if r == '-' {
+				r = SoftHyphen
+			} else if r == ' ' {
+				r = NonBreakingSpace
+			}
+			buf = append(buf, r)
+		} else if r == '*' {
+			// Bold and italic are toggled independently, so a bold span
+			// can sit inside an italic one or the other way around.
+			// Three asterisks toggle both at once: they open or close
+			// bold italic text, and close both styles when they're
+			// both open, as at the end of *italic **and bold***.
+			flipItalic := true
+			flipBold := false
+
+			double, triple := false, false
+			if double, err = follows('*'); err != nil {
+				return
+			}
+			if double {
+				if triple, err = follows('*'); err != nil {
+					return
+				}
+				flipBold, flipItalic = true, triple
+			}
+
+			flush()
+
+			if flipBold {
+				style.bold = !style.bold
+				mark(style.bold, "bold")
+			}
+			if flipItalic {
+				style.italic = !style.italic
+				mark(style.italic, "italic")
+			}
+		} else if r == '[' {
+			isNote := false
+			if isNote, err = follows('^'); err != nil {
+				return
+			}
+			if !isNote {
+				buf = append(buf, '[')
+				continue
+			}
+
+			var note Footnote
+			note, err = lexFootnote(fin)
+			if err != nil {
+				return
+			}
+
+			flush()
+			es = append(es, note)
+		} else if r == '%' && unicode.IsSpace(before) {
+			err = lexComment(fin)
+			if err != nil {
+				return
+			}
+		} else if r == '_' {
+			// Underlining opens at the start of a word and closes at
+			// the end of one, so an underscore inside a word, file name
+			// or URL is kept as it is.  A run of underscores standing
+			// on its own, like a blank to fill in, is kept too.
+			if !style.underline && unicode.IsSpace(before) &&
+				fin.runEndsAtSpace('_') {
+				buf = append(buf, '_')
+				for fin.skip("_") {
+					buf = append(buf, '_')
+				}
+				continue
+			}
+
+			boundary := !inWord(before)
+			if style.underline {
+				next := '\000'
+				next, _, err = fin.ReadRune()
+				if err == io.EOF {
+					err = nil
+				} else if err != nil {
+					return
+				} else if err = fin.UnreadRune(); err != nil {
+					return
+				}
+				boundary = !inWord(next)
+			}
+			if !boundary {
+				buf = append(buf, '_')
+				continue
+			}
+
+			flush()
+			style.underline = !style.underline
+			mark(style.underline, "underline")
+		} else if r == '~' {
+			isStrike := false
+			if isStrike, err = follows('~'); err != nil {
+				return
+			}
+			if !isStrike {
+				buf = append(buf, '~')
+				continue
+			}
+
+			flush()
+			style.strikethrough = !style.strikethrough
+			mark(style.strikethrough, "strikethrough")
+		} else if r == '{' && fin.skip("color:") {
+			if style.color != "" {
+				err = parseErrorf("Color spans can't be nested")
+				return
+			}
+
+			color := ""
+			if color, err = lexColor(fin); err != nil {
+				return
+			}
+
+			flush()
+			style.color = color
+			mark(true, "color")
+		} else if r == '{' && fin.skip("/color}") {
+			if style.color == "" {
+				err = parseErrorf("{/color} without a matching {color:...}")
+				return
+			}
+
+			flush()
+			style.color = ""
+			mark(false, "color")
+		} else {
+			buf = append(buf, r)
+		}
+	}
+
+	es = append(es, ParagraphBreak(true))
+	return
+}
+
+// inWord checks whether r is part of a word, for deciding whether an
+// '_' is underlining or just an underscore.
+func inWord(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Comments run from a '%' at the start of a line or after a space to
+// the end of the line, and are thrown away.  The newline itself is
+// left in place so that the comment doesn't disturb paragraph breaks
+// around it.
+func lexComment(fin *lineReader) error {
+	for {
+		r, _, err := fin.ReadRune()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if r == '\n' {
+			return fin.UnreadRune()
+		}
+	}
+}
+
+// A color span's color runs from "{color:" to the closing '}', and must
+// be one that every renderer can make sense of.
+func lexColor(fin *lineReader) (color string, err error) {
+	buf := []rune{}
+	for {
+		r := '\000'
+		r, _, err = fin.ReadRune()
+		if err == nil && r == '\n' {
+			// The error belongs to the line the span started on.
+			fin.UnreadRune()
+			err = io.EOF
+		}
+		if err == io.EOF {
+			err = parseErrorf("Unterminated color span")
+		}
+		if err != nil {
+			return
+		}
+
+		if r == '}' {
+			break
+		}
+		buf = append(buf, r)
+	}
+
+	color = strings.ToLower(strings.TrimSpace(string(buf)))
+	if _, _, _, ok := ColorRGB(color); !ok {
+		err = parseErrorf("Invalid color %s", string(buf))
+	}
+	return
+}
+
+// Footnotes run until the closing ']', and may contain escaped
+// characters but no other formatting.
+func lexFootnote(fin *lineReader) (note Footnote, err error) {
+	buf := []rune{}
+	for {
+		r := '\000'
+		r, _, err = fin.ReadRune()
+		if err == io.EOF {
+			err = parseErrorf("Unterminated footnote")
+		}
+		if err != nil {
+			return
+		}
+
+		if r == ']' {
+			break
+		} else if unicode.IsSpace(r) && r != NonBreakingSpace {
+			buf = addWhitespace(buf)
+		} else if r == '\\' {
+			r, _, err = fin.ReadRune()
+			if err == io.EOF {
+				err = parseErrorf("Unterminated footnote")
+			}
+			if err != nil {
+				return
+			}
+			if r == ' ' {
+				r = NonBreakingSpace
+			}
+			buf = append(buf, r)
+		} else {
+			buf = append(buf, r)
+		}
+	}
+
+	note = Footnote(strings.TrimSpace(string(buf)))
+	return
+}
+
 func parsePart(text []DocumentElement) (p Part, rest []DocumentElement) {
 	if partBreak, ok := text[0].(PartBreak); ok {
 		p.Anonymous = false
@@ -553,6 +1702,13 @@ func parseChapter(text []DocumentElement) (c Chapter, rest []DocumentElement) {
 		c.Anonymous = true
 	}
 
+	if len(text) != 0 {
+		if epigraph, ok := text[0].(Epigraph); ok {
+			c.Epigraph = &epigraph
+			text = text[1:]
+		}
+	}
+
 	var s Scene
 outer:
 	for len(text) != 0 {
@@ -576,6 +1732,45 @@ outer:
 }
 
 func parseScene(text []DocumentElement) (s Scene, rest []DocumentElement) {
+	var sec Section
+outer:
+	for len(text) != 0 {
+		sec, text = parseSection(text)
+
+		s.Sections = append(s.Sections, sec)
+		if len(text) != 0 {
+			switch e := text[0].(type) {
+			case SceneBreak:
+				text = text[1:]
+				s.EndsWithSceneBreak = true
+				s.BreakLabel = e.Label
+				break outer
+			case PrologueBreak:
+				break outer
+			case ChapterBreak:
+				break outer
+			case PartBreak:
+				break outer
+
+			}
+		}
+	}
+
+	rest = text
+	return
+}
+
+func parseSection(
+	text []DocumentElement,
+) (s Section, rest []DocumentElement) {
+	if sectionBreak, ok := text[0].(SectionBreak); ok {
+		s.Anonymous = false
+		s.Title = string(sectionBreak)
+		text = text[1:]
+	} else {
+		s.Anonymous = true
+	}
+
 	var p Paragraph
 outer:
 	for len(text) != 0 {
@@ -585,8 +1780,8 @@ outer:
 		if len(text) != 0 {
 			switch text[0].(type) {
 			case SceneBreak:
-				text = text[1:]
-				s.EndsWithSceneBreak = true
+				break outer
+			case SectionBreak:
 				break outer
 			case PrologueBreak:
 				break outer
@@ -594,7 +1789,6 @@ outer:
 				break outer
 			case PartBreak:
 				break outer
-
 			}
 		}
 	}
@@ -606,6 +1800,11 @@ outer:
 func parseParagraph(
 	text []DocumentElement,
 ) (p Paragraph, rest []DocumentElement) {
+	if alignment, ok := text[0].(Alignment); ok {
+		p.Alignment = alignment
+		text = text[1:]
+	}
+
 outer:
 	for len(text) != 0 {
 		switch text[0].(type) {
@@ -614,6 +1813,8 @@ outer:
 			break outer
 		case SceneBreak:
 			break outer
+		case SectionBreak:
+			break outer
 		case PrologueBreak:
 			break outer
 		case ChapterBreak:
@@ -630,15 +1831,59 @@ outer:
 	return
 }
 
-func formatText(text []rune, bold, italic bool) DocumentElement {
-	if italic && bold {
-		return BoldItalicText(text)
-	} else if bold {
-		return BoldText(text)
-	} else if italic {
-		return ItalicText(text)
+// textStyle tracks which inline styles are active at a given point in
+// a paragraph.
+type textStyle struct {
+	bold          bool
+	italic        bool
+	underline     bool
+	strikethrough bool
+	color         string
+}
+
+// unclosedStyle returns an error for whichever of the given styles was
+// opened first, or nil if none were left open.
+func unclosedStyle(opened map[string]int) error {
+	name, line := "", 0
+	for n, l := range opened {
+		if line == 0 || l < line || (l == line && n < name) {
+			name, line = n, l
+		}
+	}
+
+	if line == 0 {
+		return nil
+	}
+	message := fmt.Sprintf("Unclosed %s emphasis", name)
+	if name == "color" {
+		message = "Unclosed color span"
+	}
+	return &ParseError{Line: line, Message: message}
+}
+
+// Underlining takes precedence over bold and italic, since none of
+// the renderers have a way to combine them.
+func formatText(text []rune, style textStyle) DocumentElement {
+	var e DocumentElement
+	if style.underline {
+		e = UnderlineText(text)
+	} else if style.italic && style.bold {
+		e = BoldItalicText(text)
+	} else if style.bold {
+		e = BoldText(text)
+	} else if style.italic {
+		e = ItalicText(text)
+	} else {
+		e = PlainText(text)
 	}
-	return PlainText(text)
+
+	if style.color != "" {
+		e = ColoredText{Color: style.color, Text: e}
+	}
+	if style.strikethrough {
+		e = StrikethroughText{Text: e}
+	}
+	return e
 }
 
 func addWhitespace(text []rune) []rune {
@@ -648,7 +1893,7 @@ func addWhitespace(text []rune) []rune {
 	return text
 }
 
-func eatWhitespace(fin *bufio.Reader) error {
+func eatWhitespace(fin *lineReader) error {
 	for {
 		r, _, err := fin.ReadRune()
 		if err != nil {
@@ -661,13 +1906,15 @@ func eatWhitespace(fin *bufio.Reader) error {
 	}
 }
 
-func readWord(fin *bufio.Reader) (text string, err error) {
+// readWord reads up to the next whitespace.  If it reaches the end of
+// the file first, it returns whatever it read along with io.EOF.
+func readWord(fin *lineReader) (text string, err error) {
 	chars := []rune{}
 	for {
 		r := '\000'
 		r, _, err = fin.ReadRune()
 		if err != nil {
-			return
+			break
 		}
 
 		if unicode.IsSpace(r) {
@@ -682,7 +1929,7 @@ func readWord(fin *bufio.Reader) (text string, err error) {
 	return
 }
 
-func readPlainText(fin *bufio.Reader) (text string, err error) {
+func readPlainText(fin *lineReader) (text string, err error) {
 	chars := []rune{}
 	for {
 		r := '\000'
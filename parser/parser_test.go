@@ -0,0 +1,262 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parse parses the given story, failing the test if it can't be.
+func parse(t *testing.T, src string) Document {
+	t.Helper()
+	d, err := Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", src, err)
+	}
+	return d
+}
+
+// paragraphs lists every paragraph in the document, in order.
+func paragraphs(d Document) []Paragraph {
+	ps := []Paragraph{}
+	for _, part := range d.Parts {
+		for _, chapter := range part.Chapters {
+			for _, scene := range chapter.Scenes {
+				for _, section := range scene.Sections {
+					ps = append(ps, section.Paragraphs...)
+				}
+			}
+		}
+	}
+	return ps
+}
+
+// checkParagraph parses a story whose body is just body, and checks
+// that it comes out as a single paragraph with the given text.
+func checkParagraph(t *testing.T, body string, want ...DocumentElement) {
+	t.Helper()
+	ps := paragraphs(parse(t, "@title T\n@begin\n"+body))
+	if len(ps) != 1 {
+		t.Errorf("%q: got %d paragraphs, want 1", body, len(ps))
+		return
+	}
+	if !reflect.DeepEqual(ps[0].Text, want) {
+		t.Errorf("%q: got %#v, want %#v", body, ps[0].Text, want)
+	}
+}
+
+func TestNoTrailingNewline(t *testing.T) {
+	checkParagraph(t, "Last words", PlainText("Last words"))
+	checkParagraph(t, "Last *words*", PlainText("Last "), ItalicText("words"))
+	checkParagraph(t, "Last **words**\n", PlainText("Last "), BoldText("words"))
+}
+
+func TestVerseLines(t *testing.T) {
+	d := parse(
+		t,
+		"@title T\n@begin\n@verse\nOne *line*\nTwo\n@endverse\n\nAfter.\n",
+	)
+
+	ps := paragraphs(d)
+	if len(ps) != 2 {
+		t.Fatalf("got %d paragraphs, want 2", len(ps))
+	}
+	verse, ok := ps[0].Verse()
+	if !ok {
+		t.Fatalf("first paragraph isn't verse: %#v", ps[0].Text)
+	}
+
+	want := [][]DocumentElement{
+		{PlainText("One "), ItalicText("line")},
+		{PlainText("Two")},
+	}
+	if !reflect.DeepEqual(verse.Lines, want) {
+		t.Errorf("got %#v, want %#v", verse.Lines, want)
+	}
+}
+
+func TestComments(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"Some text % a note\nmore text.", "Some text more text."},
+		{"% A note\nSome text.", "Some text."},
+		{"50% of people agree.\nNext line", "50% of people agree. Next line"},
+		{"An escaped \\% sign.", "An escaped % sign."},
+	}
+
+	for _, test := range tests {
+		checkParagraph(t, test.src, PlainText(test.want))
+	}
+}
+
+func TestUnderline(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []DocumentElement
+	}{
+		{
+			"Some _underlined_ text.",
+			[]DocumentElement{
+				PlainText("Some "),
+				UnderlineText("underlined"),
+				PlainText(" text."),
+			},
+		},
+		{
+			"A snake_case word.",
+			[]DocumentElement{PlainText("A snake_case word.")},
+		},
+		{
+			"See http://example.com/a_b and my_file_name.txt",
+			[]DocumentElement{
+				PlainText("See http://example.com/a_b and my_file_name.txt"),
+			},
+		},
+		{
+			"(_snake_case_)",
+			[]DocumentElement{
+				PlainText("("),
+				UnderlineText("snake_case"),
+				PlainText(")"),
+			},
+		},
+		{
+			"An \\_escaped\\_ one.",
+			[]DocumentElement{PlainText("An _escaped_ one.")},
+		},
+		{
+			"Fill in a ___ blank, or _ this one.",
+			[]DocumentElement{PlainText("Fill in a ___ blank, or _ this one.")},
+		},
+		{
+			"A blank at the end ___",
+			[]DocumentElement{PlainText("A blank at the end ___")},
+		},
+		{
+			"___ and _then_ more",
+			[]DocumentElement{
+				PlainText("___ and "),
+				UnderlineText("then"),
+				PlainText(" more"),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		checkParagraph(t, test.src, test.want...)
+	}
+
+	_, err := Parse(strings.NewReader("@title T\n@begin\nNever _closed.\n"))
+	if err == nil {
+		t.Error("Unclosed underline parsed without an error")
+	}
+}
+
+func TestStrikethrough(t *testing.T) {
+	checkParagraph(
+		t,
+		"Some ~~struck **and bold** text~~ here.",
+		PlainText("Some "),
+		StrikethroughText{Text: PlainText("struck ")},
+		StrikethroughText{Text: BoldText("and bold")},
+		StrikethroughText{Text: PlainText(" text")},
+		PlainText(" here."),
+	)
+	checkParagraph(
+		t,
+		"**Bold ~~and struck~~**",
+		BoldText("Bold "),
+		StrikethroughText{Text: BoldText("and struck")},
+	)
+	checkParagraph(t, "A lone ~ tilde.", PlainText("A lone ~ tilde."))
+
+	_, err := Parse(strings.NewReader("@title T\n@begin\nNever ~~closed.\n"))
+	if err == nil {
+		t.Error("Unclosed strikethrough parsed without an error")
+	}
+}
+
+func TestSoftHyphens(t *testing.T) {
+	checkParagraph(
+		t,
+		"A Donau\\-dampf\\-schiff and a plain-hyphen.",
+		PlainText("A Donau\u00addampf\u00adschiff and a plain-hyphen."),
+	)
+}
+
+func TestMissingBegin(t *testing.T) {
+	sources := []string{
+		"@title T\n@type novel\n",
+		"@title T\n@type novel",
+		"@title T\n",
+	}
+	for _, src := range sources {
+		_, err := Parse(strings.NewReader(src))
+		want := "Reached end of file before @begin directive"
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got error %v, want %q", src, err, want)
+		}
+	}
+}
+
+func TestEscapedDirective(t *testing.T) {
+	checkParagraph(
+		t,
+		"\\@username said hello.\n",
+		PlainText("@username said hello."),
+	)
+}
+
+func TestTrailingBackslash(t *testing.T) {
+	checkParagraph(t, "Some text\\", PlainText("Some text\\"))
+}
+
+func TestNestedEmphasis(t *testing.T) {
+	checkParagraph(
+		t,
+		"*italic **and bold** back*",
+		ItalicText("italic "),
+		BoldItalicText("and bold"),
+		ItalicText(" back"),
+	)
+	checkParagraph(
+		t,
+		"**bold *and italic* back**",
+		BoldText("bold "),
+		BoldItalicText("and italic"),
+		BoldText(" back"),
+	)
+	checkParagraph(
+		t,
+		"*italic **and bold*** after",
+		ItalicText("italic "),
+		BoldItalicText("and bold"),
+		PlainText(" after"),
+	)
+	checkParagraph(
+		t,
+		"***both*** after",
+		BoldItalicText("both"),
+		PlainText(" after"),
+	)
+}
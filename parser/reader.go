@@ -0,0 +1,148 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package parser
+
+import (
+	"bufio"
+	"io"
+	"path/filepath"
+	"unicode"
+	"unicode/utf8"
+)
+
+// lineReader wraps a bufio.Reader to keep track of which line of the
+// input it's on, so that errors can point to where they happened.  It
+// also turns Windows (\r\n) and old Mac (\r) line endings into plain
+// newlines, so that the rest of the parser only has to look for '\n'.
+//
+// When reading from a file, path holds the file's name, and includes
+// holds the absolute paths of it and each file that @included it,
+// outermost first, so that include cycles can be caught.
+type lineReader struct {
+	*bufio.Reader
+	path      string
+	includes  []string
+	line      int
+	last      rune
+	size      int
+	unread    bool
+	canUnread bool
+}
+
+// resolve finds a path written in the file being read.  Relative paths
+// are taken from that file's directory, or left as they are if we
+// aren't reading from a file.
+func (l *lineReader) resolve(path string) string {
+	if filepath.IsAbs(path) || l.path == "" {
+		return path
+	}
+	return filepath.Join(filepath.Dir(l.path), path)
+}
+
+// newLineReader starts reading from the beginning of rawFIN.  Some
+// editors start their files with a byte-order mark, which we can simply
+// skip over.
+func newLineReader(rawFIN io.Reader) *lineReader {
+	fin := &lineReader{Reader: bufio.NewReader(rawFIN), line: 1}
+	if r, _, err := fin.ReadRune(); err == nil && r != '\uFEFF' {
+		fin.UnreadRune()
+	}
+	return fin
+}
+
+func (l *lineReader) ReadRune() (r rune, size int, err error) {
+	if l.unread {
+		l.unread = false
+		r, size = l.last, l.size
+	} else {
+		r, size, err = l.Reader.ReadRune()
+		if err != nil {
+			l.canUnread = false
+			return
+		}
+
+		if r == '\r' {
+			next, _ := l.Reader.Peek(1)
+			if len(next) == 1 && next[0] == '\n' {
+				l.Reader.ReadByte()
+				size++
+			}
+			r = '\n'
+		}
+	}
+
+	l.last, l.size, l.canUnread = r, size, true
+	if r == '\n' {
+		l.line++
+	}
+	return
+}
+
+func (l *lineReader) UnreadRune() error {
+	if !l.canUnread {
+		return bufio.ErrInvalidUnreadRune
+	}
+
+	l.unread, l.canUnread = true, false
+	if l.last == '\n' {
+		l.line--
+	}
+	return nil
+}
+
+// skip consumes s if it's what the input continues with, and reports
+// whether it did.  It can't see a rune that's been unread, so it's
+// only meant to be called right after reading one.
+func (l *lineReader) skip(s string) bool {
+	if l.unread {
+		return false
+	}
+
+	next, err := l.Reader.Peek(len(s))
+	if err != nil || string(next) != s {
+		return false
+	}
+	l.Reader.Discard(len(s))
+	l.canUnread = false
+	return true
+}
+
+// runEndsAtSpace checks whether the run of b coming up in the input,
+// if there is one, is followed by whitespace or the end of the input,
+// without reading any of it.  b has to be an ASCII character, and like
+// skip it's only meant to be called right after reading a rune.
+func (l *lineReader) runEndsAtSpace(b byte) bool {
+	if l.unread {
+		return false
+	}
+
+	for i := 1; ; i++ {
+		next, err := l.Reader.Peek(i)
+		if err == io.EOF {
+			return true
+		} else if err != nil {
+			return false
+		}
+		if next[i-1] != b {
+			rest, _ := l.Reader.Peek(i - 1 + utf8.UTFMax)
+			r, _ := utf8.DecodeRune(rest[i-1:])
+			return unicode.IsSpace(r)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLineEndings(t *testing.T) {
+	unix := "@title My Story\n@authorName Someone\n@begin\n" +
+		"First line\nsecond line.\n\nNext paragraph.\n"
+	want := parse(t, unix)
+
+	endings := map[string]string{
+		"windows": "\r\n",
+		"old mac": "\r",
+	}
+	for name, ending := range endings {
+		d := parse(t, strings.Replace(unix, "\n", ending, -1))
+		if d.Title != "My Story" || d.Author.Name != "Someone" {
+			t.Errorf(
+				"%s: got %q by %q, want \"My Story\" by \"Someone\"",
+				name,
+				d.Title,
+				d.Author.Name,
+			)
+		}
+		if !reflect.DeepEqual(paragraphs(d), paragraphs(want)) {
+			t.Errorf(
+				"%s: got %#v, want %#v",
+				name,
+				paragraphs(d),
+				paragraphs(want),
+			)
+		}
+	}
+}
+
+func TestLineEndingsErrorLine(t *testing.T) {
+	_, err := Parse(
+		strings.NewReader("@title T\r\n@begin\r\n\r\nNever *closed.\r\n"),
+	)
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("got %v, want a ParseError", err)
+	}
+	if parseErr.Line != 4 {
+		t.Errorf("got an error on line %d, want line 4", parseErr.Line)
+	}
+}
+
+func TestByteOrderMark(t *testing.T) {
+	src := "@title T\n@begin\nSome text.\n"
+	want := parse(t, src)
+	got := parse(t, "\ufeff"+src)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
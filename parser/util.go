@@ -19,39 +19,417 @@
 package parser
 
 import (
+	"errors"
 	"math"
+	"strconv"
 	"strings"
 )
 
+// Validate checks for metadata that the story can be rendered without,
+// but that renderers expect to find, and returns a warning for each
+// piece that's missing.
+func (d Document) Validate() []error {
+	warnings := []error{}
+	if d.Title == "" {
+		warnings = append(warnings, errors.New("Missing @title"))
+	}
+	if d.ShortTitle == "" {
+		warnings = append(warnings, errors.New("Missing @shortTitle"))
+	}
+	if d.Author.Byline == "" {
+		warnings = append(warnings, errors.New("Missing @authorByline"))
+	}
+	if d.Author.ShortName == "" {
+		warnings = append(warnings, errors.New("Missing @authorShortName"))
+	}
+	return warnings
+}
+
+// SelectPart returns a copy of the document with only the part of the
+// given number.  The untitled text before the first part has no number
+// of its own, so it's never selected.
+func (d Document) SelectPart(number int) Document {
+	parts := []Part{}
+	for _, p := range d.Parts {
+		if !p.Anonymous && p.Number == number {
+			parts = append(parts, p)
+		}
+	}
+	d.Parts = parts
+	return d
+}
+
+// SelectChapters returns a copy of the document with only the chapters
+// numbered first through last, in every part.  Chapters keep their
+// original numbers, so their labels are the same as in the full story.
+// Prologues and the untitled text before a part's first chapter aren't
+// numbered chapters, so they're left out, along with any part that's
+// left without chapters.
+func (d Document) SelectChapters(first, last int) Document {
+	parts := []Part{}
+	for _, p := range d.Parts {
+		chapters := []Chapter{}
+		for _, c := range p.Chapters {
+			if c.Anonymous || c.Prologue {
+				continue
+			}
+			if c.Number >= first && c.Number <= last {
+				chapters = append(chapters, c)
+			}
+		}
+
+		if len(chapters) != 0 {
+			p.Chapters = chapters
+			parts = append(parts, p)
+		}
+	}
+	d.Parts = parts
+	return d
+}
+
+// Lang returns the language code of the story, as in en-US, for
+// renderers to mark their output with.  Stories without a @language
+// directive are taken to be in English.
+func (d Document) Lang() string {
+	if d.Language == "" {
+		return "en"
+	}
+	return d.Language
+}
+
+// RightToLeft checks whether the story's text runs from right to left,
+// as in Hebrew or Arabic.  Stories run from left to right unless they
+// say otherwise with @direction.
+func (d Document) RightToLeft() bool {
+	return d.Direction == "rtl"
+}
+
 // WordCount returns an approximate word count for the document,
 // rounded to the nearest 100 words for stories < 15,000 words, and to
 // the nearest 500 for anything longer.
 func (d Document) WordCount() int64 {
+	count := 0
+	for _, p := range d.Parts {
+		count += p.wordCount()
+	}
+	return roundWordCount(count)
+}
+
+// PageEstimate returns the approximate number of manuscript pages the
+// document would fill at the given number of words per page, rounded
+// up to a whole page.  There's no sensible estimate without a positive
+// number of words per page, so it returns 0 for anything else.
+func (d Document) PageEstimate(wordsPerPage int) int {
+	if wordsPerPage <= 0 {
+		return 0
+	}
+
+	count := 0
+	for _, p := range d.Parts {
+		count += p.wordCount()
+	}
+	return (count + wordsPerPage - 1) / wordsPerPage
+}
+
+// WordCount returns an approximate word count for the part, rounded
+// the same way as the document's word count.
+func (p Part) WordCount() int64 {
+	return roundWordCount(p.wordCount())
+}
+
+// WordCount returns an approximate word count for the chapter,
+// rounded the same way as the document's word count.
+func (c Chapter) WordCount() int64 {
+	return roundWordCount(c.wordCount())
+}
+
+func (p Part) wordCount() int {
+	count := 0
+	for _, c := range p.Chapters {
+		count += c.wordCount()
+	}
+	return count
+}
+
+func (c Chapter) wordCount() int {
+	count := 0
+	for _, s := range c.Scenes {
+		for _, sec := range s.Sections {
+			for _, p := range sec.Paragraphs {
+				count += wordCount(p.Text)
+			}
+		}
+	}
+	return count
+}
+
+// PartCount returns the number of parts in the document.  The
+// anonymous part that holds a story without any @part directives isn't
+// counted, so such a story has no parts.
+func (d Document) PartCount() int {
+	count := 0
+	for _, p := range d.Parts {
+		if !p.Anonymous {
+			count++
+		}
+	}
+	return count
+}
+
+// ChapterCount returns the number of chapters in the document.  With
+// all set, every chapter is counted, including prologues and the
+// anonymous chapters that hold text outside any @chapter directive, so
+// a story with no chapters at all counts as one.  Otherwise only the
+// numbered chapters are counted.
+func (d Document) ChapterCount(all bool) int {
 	count := 0
 	for _, p := range d.Parts {
 		for _, c := range p.Chapters {
-			for _, s := range c.Scenes {
-				for _, p := range s.Paragraphs {
-					for _, e := range p.Text {
-						switch e := e.(type) {
-						case PlainText:
-							count += len(strings.Split(string(e), " "))
-						case ItalicText:
-							count += len(strings.Split(string(e), " "))
-						case BoldText:
-							count += len(strings.Split(string(e), " "))
-						case BoldItalicText:
-							count += len(strings.Split(string(e), " "))
-						}
-					}
-				}
+			if all || (!c.Anonymous && !c.Prologue) {
+				count++
 			}
 		}
 	}
+	return count
+}
+
+// SceneCount returns the number of scenes in the document, counting
+// every chapter, anonymous chapters and prologues included.  A chapter
+// without any scene breaks is a single scene.
+func (d Document) SceneCount() int {
+	count := 0
+	for _, p := range d.Parts {
+		for _, c := range p.Chapters {
+			count += len(c.Scenes)
+		}
+	}
+	return count
+}
+
+// Authors returns the document's primary author followed by any
+// co-authors.
+func (d Document) Authors() []Author {
+	return append([]Author{d.Author}, d.CoAuthors...)
+}
+
+// Byline returns the bylines of all of the document's authors, joined
+// as in "X and Y" or "X, Y and Z".
+func (d Document) Byline() string {
+	names := []string{}
+	for _, a := range d.Authors() {
+		names = append(names, a.Byline)
+	}
+	return joinNames(names)
+}
+
+// ShortName returns the short names of all of the document's authors,
+// joined the same way as Byline.
+func (d Document) ShortName() string {
+	names := []string{}
+	for _, a := range d.Authors() {
+		names = append(names, a.ShortName)
+	}
+	return joinNames(names)
+}
+
+func joinNames(names []string) string {
+	nonEmpty := []string{}
+	for _, n := range names {
+		if n != "" {
+			nonEmpty = append(nonEmpty, n)
+		}
+	}
+
+	if len(nonEmpty) < 2 {
+		return strings.Join(nonEmpty, "")
+	}
+	last := len(nonEmpty) - 1
+	return strings.Join(nonEmpty[:last], ", ") + " and " + nonEmpty[last]
+}
+
+// Image returns the paragraph's image if the paragraph is an
+// illustration.
+func (p Paragraph) Image() (Image, bool) {
+	if len(p.Text) != 1 {
+		return Image{}, false
+	}
+	i, ok := p.Text[0].(Image)
+	return i, ok
+}
+
+// Images returns every image in the document, in order, including any
+// in the afterword or in conditional blocks.
+func (d Document) Images() []Image {
+	images := []Image{}
+	d.Walk(func(e DocumentElement) {
+		if image, ok := e.(Image); ok {
+			images = append(images, image)
+		}
+	})
+	return images
+}
+
+// Verse returns the paragraph's verse block if the paragraph is a
+// passage of verse.
+func (p Paragraph) Verse() (VerseBlock, bool) {
+	if len(p.Text) != 1 {
+		return VerseBlock{}, false
+	}
+	v, ok := p.Text[0].(VerseBlock)
+	return v, ok
+}
+
+// Raw returns the paragraph's raw block if the paragraph is a snippet
+// meant for a single renderer.
+func (p Paragraph) Raw() (RawBlock, bool) {
+	if len(p.Text) != 1 {
+		return RawBlock{}, false
+	}
+	r, ok := p.Text[0].(RawBlock)
+	return r, ok
+}
+
+// Conditional returns the paragraph's conditional block if the
+// paragraph holds content meant only for some renderers.
+func (p Paragraph) Conditional() (ConditionalBlock, bool) {
+	if len(p.Text) != 1 {
+		return ConditionalBlock{}, false
+	}
+	c, ok := p.Text[0].(ConditionalBlock)
+	return c, ok
+}
+
+// Spoiler returns the paragraph's spoiler block if the paragraph holds
+// text to be hidden from the reader.
+func (p Paragraph) Spoiler() (SpoilerBlock, bool) {
+	if len(p.Text) != 1 {
+		return SpoilerBlock{}, false
+	}
+	s, ok := p.Text[0].(SpoilerBlock)
+	return s, ok
+}
+
+// RenderedBy checks whether the named renderer should include the
+// paragraph at all.  Raw blocks for other renderers and conditional
+// blocks that leave the renderer out are skipped entirely.
+func (p Paragraph) RenderedBy(renderer string) bool {
+	if raw, ok := p.Raw(); ok {
+		return raw.Renderer == renderer
+	}
+	if block, ok := p.Conditional(); ok {
+		return block.Includes(renderer)
+	}
+	return true
+}
 
+func roundWordCount(count int) int64 {
 	granularity := 100.0
 	if count > 15000 {
 		granularity = 500.0
 	}
 	return int64(granularity * math.Floor((float64(count)/granularity)+0.5))
 }
+
+// wordCount counts the whitespace-separated words in a run of
+// elements.  Markup can split a single word across several elements,
+// as in un*believ*able, so the text of neighboring elements is joined
+// up before it's split into words.
+func wordCount(elements []DocumentElement) int {
+	count, text := 0, ""
+	for _, e := range elements {
+		switch e := e.(type) {
+		case VerseBlock:
+			for _, l := range e.Lines {
+				count += wordCount(l)
+			}
+		case SpoilerBlock:
+			for _, p := range e.Paragraphs {
+				count += wordCount(p.Text)
+			}
+		default:
+			text += elementText(e)
+		}
+	}
+	return count + len(strings.Fields(text))
+}
+
+// elementText returns the text an element adds to the word count.
+// Anything that isn't part of the prose, like a footnote, still ends
+// the word before it.
+func elementText(e DocumentElement) string {
+	switch e := e.(type) {
+	case PlainText:
+		return string(e)
+	case ItalicText:
+		return string(e)
+	case BoldText:
+		return string(e)
+	case BoldItalicText:
+		return string(e)
+	case UnderlineText:
+		return string(e)
+	case StrikethroughText:
+		return elementText(e.Text)
+	case ColoredText:
+		return elementText(e.Text)
+	}
+	return " "
+}
+
+// ColorNames maps the color names accepted in color spans to their RGB
+// values.  They're the basic HTML colors, which forum software also
+// understands, plus orange.
+var ColorNames = map[string][3]int{
+	"black":   {0x00, 0x00, 0x00},
+	"silver":  {0xc0, 0xc0, 0xc0},
+	"gray":    {0x80, 0x80, 0x80},
+	"white":   {0xff, 0xff, 0xff},
+	"maroon":  {0x80, 0x00, 0x00},
+	"red":     {0xff, 0x00, 0x00},
+	"purple":  {0x80, 0x00, 0x80},
+	"fuchsia": {0xff, 0x00, 0xff},
+	"green":   {0x00, 0x80, 0x00},
+	"lime":    {0x00, 0xff, 0x00},
+	"olive":   {0x80, 0x80, 0x00},
+	"yellow":  {0xff, 0xff, 0x00},
+	"navy":    {0x00, 0x00, 0x80},
+	"blue":    {0x00, 0x00, 0xff},
+	"teal":    {0x00, 0x80, 0x80},
+	"aqua":    {0x00, 0xff, 0xff},
+	"orange":  {0xff, 0xa5, 0x00},
+}
+
+// ColorRGB returns the RGB value of a color given by name or as a hex
+// value in the #rgb or #rrggbb forms.  ok is false if the color isn't
+// one of those.
+func ColorRGB(color string) (r, g, b int, ok bool) {
+	if rgb, ok := ColorNames[strings.ToLower(color)]; ok {
+		return rgb[0], rgb[1], rgb[2], true
+	}
+
+	if !strings.HasPrefix(color, "#") {
+		return 0, 0, 0, false
+	}
+	hex := color[1:]
+	if len(hex) == 3 {
+		hex = string([]byte{
+			hex[0], hex[0], hex[1], hex[1], hex[2], hex[2],
+		})
+	}
+	if len(hex) != 6 {
+		return 0, 0, 0, false
+	}
+
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	return int(value >> 16), int(value >> 8 & 0xff), int(value & 0xff), true
+}
+
+// RGB returns the RGB value of the text's color, or black if the color
+// isn't one ColorRGB understands.
+func (c ColoredText) RGB() (r, g, b int) {
+	r, g, b, _ = ColorRGB(c.Color)
+	return
+}
@@ -0,0 +1,149 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package parser
+
+import (
+	"testing"
+)
+
+func TestPageEstimate(t *testing.T) {
+	d := parse(t, "@title T\n@begin\nOne two three four five.\n")
+
+	tests := []struct {
+		wordsPerPage int
+		want         int
+	}{
+		{5, 1},
+		{2, 3},
+		{250, 1},
+		{0, 0},
+		{-1, 0},
+	}
+	for _, test := range tests {
+		if got := d.PageEstimate(test.wordsPerPage); got != test.want {
+			t.Errorf(
+				"PageEstimate(%d) = %d, want %d",
+				test.wordsPerPage,
+				got,
+				test.want,
+			)
+		}
+	}
+}
+
+func TestWordCount(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"one two three", 3},
+		{"one  two   three", 3},
+		{"  one two three  ", 3},
+		{"\tone\ntwo three\n", 3},
+		{"   ", 0},
+		{"", 0},
+	}
+	for _, test := range tests {
+		elements := []DocumentElement{PlainText(test.text)}
+		if got := wordCount(elements); got != test.want {
+			t.Errorf("wordCount(%q) = %d, want %d", test.text, got, test.want)
+		}
+	}
+}
+
+func TestWordCountMarkup(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"the *quick* fox", 3},
+		{"the **quick** fox", 3},
+		{"un*believ*able", 1},
+		{"*one* *two* *three*", 3},
+		{"one ~~two~~ three", 3},
+		{"one_two_ three", 2},
+	}
+	for _, test := range tests {
+		d := parse(t, "@title T\n@begin\n"+test.text+"\n")
+		count := 0
+		for _, p := range paragraphs(d) {
+			count += wordCount(p.Text)
+		}
+		if count != test.want {
+			t.Errorf("%q: got %d words, want %d", test.text, count, test.want)
+		}
+	}
+}
+
+func TestStructureCounts(t *testing.T) {
+	d := parse(
+		t,
+		`@title T
+@begin
+@prologue
+Before the first part.
+@part One
+@prologue
+The part's own prologue.
+@chapter
+The first scene.
+@scene
+The second scene.
+@chapter
+Just one scene.
+@part Two
+@chapter
+One.
+@scene
+Two.
+@scene
+Three.
+`,
+	)
+
+	if got := d.PartCount(); got != 2 {
+		t.Errorf("PartCount() = %d, want 2", got)
+	}
+	if got := d.ChapterCount(false); got != 3 {
+		t.Errorf("ChapterCount(false) = %d, want 3", got)
+	}
+	if got := d.ChapterCount(true); got != 5 {
+		t.Errorf("ChapterCount(true) = %d, want 5", got)
+	}
+	if got := d.SceneCount(); got != 8 {
+		t.Errorf("SceneCount() = %d, want 8", got)
+	}
+}
+
+func TestStructureCountsWithoutChapters(t *testing.T) {
+	d := parse(t, "@title T\n@begin\nOne.\n@scene\nTwo.\n")
+
+	if got := d.PartCount(); got != 0 {
+		t.Errorf("PartCount() = %d, want 0", got)
+	}
+	if got := d.ChapterCount(false); got != 0 {
+		t.Errorf("ChapterCount(false) = %d, want 0", got)
+	}
+	if got := d.ChapterCount(true); got != 1 {
+		t.Errorf("ChapterCount(true) = %d, want 1", got)
+	}
+	if got := d.SceneCount(); got != 2 {
+		t.Errorf("SceneCount() = %d, want 2", got)
+	}
+}
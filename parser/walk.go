@@ -0,0 +1,87 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package parser
+
+// Walk calls visitor with each element of the story in order, part by
+// part, chapter by chapter, scene by scene, and paragraph by
+// paragraph, followed by the elements of the afterword.  Structural
+// markers like chapter breaks aren't part of the parsed document, so
+// they're never visited.
+func (d Document) Walk(visitor func(DocumentElement)) {
+	for _, p := range d.Parts {
+		p.Walk(visitor)
+	}
+	for _, para := range d.AfterMatter {
+		para.Walk(visitor)
+	}
+}
+
+// Walk calls visitor with each element of the part in order.
+func (p Part) Walk(visitor func(DocumentElement)) {
+	for _, c := range p.Chapters {
+		c.Walk(visitor)
+	}
+}
+
+// Walk calls visitor with each element of the chapter in order.  The
+// epigraph isn't included.
+func (c Chapter) Walk(visitor func(DocumentElement)) {
+	for _, s := range c.Scenes {
+		for _, sec := range s.Sections {
+			for _, para := range sec.Paragraphs {
+				para.Walk(visitor)
+			}
+		}
+	}
+}
+
+// Walk calls visitor with each element of the paragraph in order.
+// Elements that hold others, such as verse blocks, struck-through text,
+// and conditional blocks, are visited first and then followed by each
+// element inside them.
+func (p Paragraph) Walk(visitor func(DocumentElement)) {
+	for _, e := range p.Text {
+		walkElement(e, visitor)
+	}
+}
+
+func walkElement(e DocumentElement, visitor func(DocumentElement)) {
+	visitor(e)
+
+	switch e := e.(type) {
+	case StrikethroughText:
+		walkElement(e.Text, visitor)
+	case ColoredText:
+		walkElement(e.Text, visitor)
+	case VerseBlock:
+		for _, line := range e.Lines {
+			for _, le := range line {
+				walkElement(le, visitor)
+			}
+		}
+	case ConditionalBlock:
+		for _, para := range e.Paragraphs {
+			para.Walk(visitor)
+		}
+	case SpoilerBlock:
+		for _, para := range e.Paragraphs {
+			para.Walk(visitor)
+		}
+	}
+}
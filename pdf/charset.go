@@ -0,0 +1,212 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package pdf
+
+import (
+	"fmt"
+	"github.com/bieber/manuscript/parser"
+	"strings"
+)
+
+// charsetChecker collects the characters the core fonts can't show,
+// along with where in the story each one turned up.
+type charsetChecker struct {
+	translate func(string) string
+	problems  []string
+}
+
+// check notes any characters in text that the core fonts can't show.
+// They're encoded as Windows-1252, which has most accented Latin
+// letters along with typographic quotes and dashes, and gofpdf's
+// translator turns anything else into a period.
+func (c *charsetChecker) check(where string, texts ...string) {
+	seen := map[rune]bool{}
+	bad := []rune{}
+	for _, text := range texts {
+		for _, r := range text {
+			if r < 0x80 || seen[r] {
+				continue
+			}
+			seen[r] = true
+			if c.translate(string(r)) == "." {
+				bad = append(bad, r)
+			}
+		}
+	}
+
+	if len(bad) != 0 {
+		c.problems = append(
+			c.problems,
+			fmt.Sprintf("%q in %s", string(bad), where),
+		)
+	}
+}
+
+func (c *charsetChecker) checkParagraphs(
+	where string,
+	paragraphs []parser.Paragraph,
+) {
+	for i, p := range paragraphs {
+		// Only what actually ends up in the PDF matters.
+		if !p.RenderedBy("pdf") {
+			continue
+		}
+		if _, ok := p.Raw(); ok {
+			continue
+		}
+
+		texts := []string{}
+		p.Walk(func(e parser.DocumentElement) {
+			texts = append(texts, elementText(e))
+		})
+		c.check(fmt.Sprintf("%s, paragraph %d", where, i+1), texts...)
+	}
+}
+
+// checkCharacters makes sure every character in the story can be
+// written in the core font, so that nothing silently comes out
+// garbled.  TrueType fonts are written as UTF-8 and can take anything
+// the font itself has.
+func (r *Renderer) checkCharacters() error {
+	if r.translate == nil {
+		return nil
+	}
+
+	document := r.document
+	c := &charsetChecker{translate: r.translate}
+
+	// Blind submissions leave the author out of the title page and
+	// header, so it doesn't matter what's in their name.
+	if r.showTitlePage {
+		titlePage := []string{document.Title}
+		if !r.anonymous {
+			titlePage = append(titlePage, document.Byline())
+			for _, a := range document.Authors() {
+				titlePage = append(titlePage, a.Name, a.PhoneNumber)
+				titlePage = append(titlePage, a.EmailAddress, a.Website)
+				titlePage = append(titlePage, a.Address...)
+				titlePage = append(titlePage, a.SocialLinks...)
+				titlePage = append(titlePage, a.ProfessionalOrgs...)
+			}
+			titlePage = append(titlePage, r.bylinePrefix)
+		}
+		if document.Type == parser.Novel {
+			titlePage = append(titlePage, r.novelPrefix)
+		}
+		c.check("the title page", titlePage...)
+	}
+
+	// The header's fields are filled in from the story, and anything
+	// else in it comes from the headerFormat option.
+	header := []string{}
+	for _, token := range r.header {
+		switch token.field {
+		case "author":
+			header = append(header, document.ShortName())
+		case "title":
+			header = append(header, document.ShortTitle)
+		default:
+			header = append(header, token.text)
+		}
+	}
+	c.check("the page header", header...)
+	c.check("the dedication", document.Dedication...)
+
+	// The labels, scene breaks and end marker all come from options,
+	// but they're written in the same font as the story.
+	labels := r.labels
+	c.check(
+		"the part and chapter labels",
+		labels.Part,
+		labels.Chapter,
+		labels.Prologue,
+		labels.Separator,
+	)
+	c.check("the scene break", r.sceneBreak.Glyph)
+	if r.endMarker {
+		c.check("the end marker", r.endMarkerText)
+	}
+
+	for _, p := range document.Parts {
+		if !p.Anonymous {
+			c.check(r.labels.PartLabel(p.Number, p.Title), p.Title)
+		}
+
+		for _, ch := range p.Chapters {
+			where := "the story"
+			if ch.Prologue {
+				where = r.labels.PrologueLabel(ch.Title)
+			} else if !ch.Anonymous {
+				where = r.labels.ChapterLabel(ch.Number, ch.Title)
+			}
+
+			c.check(where, ch.Title)
+			if ch.Epigraph != nil {
+				c.check(
+					where+", epigraph",
+					ch.Epigraph.Text,
+					ch.Epigraph.Attribution,
+				)
+			}
+
+			paragraphs := []parser.Paragraph{}
+			for _, s := range ch.Scenes {
+				c.check(where, s.BreakLabel)
+				for _, sec := range s.Sections {
+					c.check(where, sec.Title)
+					paragraphs = append(paragraphs, sec.Paragraphs...)
+				}
+			}
+			c.checkParagraphs(where, paragraphs)
+		}
+	}
+	c.checkParagraphs("the afterword", document.AfterMatter)
+
+	if len(c.problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf(
+		"Characters the PDF font can't show, try the ttfFont option: %s",
+		strings.Join(c.problems, "; "),
+	)
+}
+
+// elementText returns the text of a single element, not counting any
+// elements inside it.
+func elementText(e parser.DocumentElement) string {
+	switch e := e.(type) {
+	case parser.PlainText:
+		return string(e)
+	case parser.ItalicText:
+		return string(e)
+	case parser.BoldText:
+		return string(e)
+	case parser.BoldItalicText:
+		return string(e)
+	case parser.UnderlineText:
+		return string(e)
+	case parser.Footnote:
+		return string(e)
+	case parser.Image:
+		return e.Caption
+	case parser.SpoilerBlock:
+		return e.Title
+	}
+	return ""
+}
@@ -0,0 +1,98 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package pdf
+
+import (
+	"fmt"
+	"github.com/jung-kurt/gofpdf"
+	"os"
+)
+
+// ttfFamily is the name gofpdf knows the fonts from the ttf options
+// by.
+const ttfFamily = "ttf"
+
+// ttfStyles maps each of the ttf options to the gofpdf style of the
+// font it supplies.
+var ttfStyles = map[string]string{
+	"ttfFont":           "",
+	"ttfBoldFont":       "B",
+	"ttfItalicFont":     "I",
+	"ttfBoldItalicFont": "BI",
+}
+
+// checkFonts makes sure any TrueType fonts given actually exist.
+func (r *Renderer) checkFonts() error {
+	for _, path := range r.ttfFonts {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("Invalid TrueType font %s", path)
+		}
+	}
+	return nil
+}
+
+// addFonts registers the TrueType fonts with gofpdf, so that text can
+// be written in any script the fonts cover.  Styles without a font of
+// their own fall back to the regular one, since gofpdf refuses to
+// switch to a style it doesn't have.
+func (r *Renderer) addFonts() {
+	if len(r.ttfFonts) == 0 {
+		return
+	}
+
+	for _, style := range ttfStyles {
+		path, ok := r.ttfFonts[style]
+		if !ok {
+			path = r.ttfFonts[""]
+		}
+		r.pdf.AddUTF8Font(ttfFamily, style, path)
+	}
+}
+
+// italicStyle picks the style for italic text: the given TrueType
+// style if there's a font file for it, or the underlined style that
+// manuscript format calls for otherwise.
+func (r *Renderer) italicStyle(ttfStyle, underlined string) string {
+	if _, ok := r.ttfFonts[ttfStyle]; ok {
+		return ttfStyle
+	}
+	return underlined
+}
+
+// setEncoding picks how text is encoded for the fonts in use.  The
+// core fonts are encoded as Windows-1252, while TrueType fonts take
+// UTF-8 just as it is.  gofpdf only hands out its translators from a
+// document, but they don't depend on anything in it.
+func (r *Renderer) setEncoding() {
+	r.translate = nil
+	if len(r.ttfFonts) == 0 {
+		pdf := gofpdf.New(r.pageOrientation, "pt", r.pageSize, "")
+		r.translate = pdf.UnicodeTranslatorFromDescriptor("cp1252")
+	}
+}
+
+// encode prepares text to be written in the current font.  Characters
+// the core fonts don't have come out as periods, which is why
+// checkCharacters looks for them first.
+func (r *Renderer) encode(text string) string {
+	if r.translate == nil {
+		return text
+	}
+	return r.translate(text)
+}
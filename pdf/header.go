@@ -0,0 +1,162 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package pdf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const defaultHeaderFormat = "{author} / {title} / {page}"
+
+var headerPositions = map[string]bool{
+	"top-right":     true,
+	"top-center":    true,
+	"bottom-center": true,
+}
+
+// headerToken is a piece of a parsed header format.  Each token is
+// either literal text or the name of a field to substitute.
+type headerToken struct {
+	text  string
+	field string
+}
+
+func parseHeaderFormat(format string) ([]headerToken, error) {
+	tokens := []headerToken{}
+	for format != "" {
+		start := strings.Index(format, "{")
+		if start == -1 {
+			tokens = append(tokens, headerToken{text: format})
+			break
+		}
+		if start != 0 {
+			tokens = append(tokens, headerToken{text: format[:start]})
+		}
+
+		end := strings.Index(format[start:], "}")
+		if end == -1 {
+			return nil, fmt.Errorf("Unterminated field in header %s", format)
+		}
+		end += start
+
+		field := format[start+1 : end]
+		if field != "author" && field != "title" && field != "page" {
+			return nil, fmt.Errorf("Invalid field {%s} in PDF header", field)
+		}
+		tokens = append(tokens, headerToken{field: field})
+		format = format[end+1:]
+	}
+	return tokens, nil
+}
+
+// anonymizeHeader drops the {author} field from a header, along with
+// the separator that follows it (or precedes it, if it comes last), so
+// that the default header becomes just the short title and page.
+func anonymizeHeader(tokens []headerToken) []headerToken {
+	anonymized := []headerToken{}
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i].field != "author" {
+			anonymized = append(anonymized, tokens[i])
+			continue
+		}
+
+		if i+1 < len(tokens) && tokens[i+1].field == "" {
+			i++
+		} else if n := len(anonymized); n != 0 &&
+			anonymized[n-1].field == "" {
+			anonymized = anonymized[:n-1]
+		}
+	}
+	return anonymized
+}
+
+func (r *Renderer) headerText() string {
+	document := r.document
+	pageNumber := r.pdf.PageNo() - r.firstBodyPage + 1
+
+	text := ""
+	for _, token := range r.header {
+		switch token.field {
+		case "author":
+			text += document.ShortName()
+		case "title":
+			text += document.ShortTitle
+		case "page":
+			text += strconv.Itoa(pageNumber)
+		default:
+			text += token.text
+		}
+	}
+	return r.encode(text)
+}
+
+// numberedPage reports whether the current page should carry a
+// header.  The cover and title page never do, and neither does any
+// front matter before the first page of prose.  Without a title page,
+// titlePage is 0 and the prose is numbered from the first page.
+func (r *Renderer) numberedPage() bool {
+	return r.pdf.PageNo() > r.titlePage && r.firstBodyPage != 0
+}
+
+func (r *Renderer) writeHeader() {
+	pdf := r.pdf
+	if !r.numberedPage() || r.headerPosition == "bottom-center" {
+		return
+	}
+
+	w, _ := pdf.GetPageSize()
+	pdf.SetXY(ptsPerInch, ptsPerInch)
+	if r.headerPosition == "top-center" {
+		pdf.WriteAligned(w-2*ptsPerInch, r.singleSpace, r.headerText(), "C")
+	} else {
+		pdf.WriteAligned(
+			// This calculation continues to baffle me, and I suspect
+			// that there's something screwy going on in the gofpdf
+			// library.  For some reason using what seems like the
+			// appropriate width (w - 2 * ptsPerInch) makes the header
+			// render too far away from the right margin, but leaving
+			// out the -10 factor for whatever reason causes it to line
+			// break even for very short text.
+			w-ptsPerInch-10,
+			r.singleSpace,
+			r.headerText(),
+			"R",
+		)
+	}
+	// The body text starts two lines of text below the header, which
+	// keeps the header clear of the text no matter what line spacing
+	// is in use.
+	pdf.SetXY(ptsPerInch, ptsPerInch+2*r.fontSize)
+}
+
+// Headers positioned at the bottom of the page are actually written as
+// the page's footer, centered in the bottom margin.
+func (r *Renderer) writeFooter() {
+	pdf := r.pdf
+	if !r.numberedPage() || r.headerPosition != "bottom-center" {
+		return
+	}
+
+	w, h := pdf.GetPageSize()
+	pdf.SetFont(r.font, "", r.fontSize)
+	pdf.SetXY(ptsPerInch, h-ptsPerInch/2-r.singleSpace/2)
+	pdf.WriteAligned(w-2*ptsPerInch, r.singleSpace, r.headerText(), "C")
+}
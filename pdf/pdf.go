@@ -19,6 +19,7 @@
 package pdf
 
 import (
+	"errors"
 	"fmt"
 	"github.com/bieber/manuscript/parser"
 	"github.com/bieber/manuscript/renderers"
@@ -26,23 +27,197 @@ import (
 	"github.com/dustin/go-humanize"
 	"github.com/jung-kurt/gofpdf"
 	"io"
+	"os"
+	"strconv"
 	"strings"
 )
 
-const fontFamily = "Courier"
+// The core fonts built into gofpdf, keyed by the lowercased name
+// accepted for the font option.
+var fontFamilies = map[string]string{
+	"courier":   "Courier",
+	"times":     "Times",
+	"arial":     "Arial",
+	"helvetica": "Helvetica",
+}
 
 const ptsPerInch = 72
-const fontSize = 12
-const singleSpace = fontSize * 1.15
-const doubleSpace = fontSize * 2
+
+var chapterPositions = map[string]bool{
+	"center": true,
+	"third":  true,
+	"top":    true,
+}
 
 // Renderer provides a Render method to render the given document to a
 // PDF file.
 type Renderer struct {
-	pageSize        string
-	pageOrientation string
-	document        parser.Document
-	pdf             *gofpdf.Fpdf
+	pageSize         string
+	pageOrientation  string
+	sceneBreak       renderers.SceneSeparator
+	scenePageBreak   bool
+	numberScenes     bool
+	indentFirst      bool
+	unindented       bool
+	allowHyphenation bool
+	endMarker        bool
+	endMarkerText    string
+	dropCap          bool
+	opening          bool
+	labels           util.Labels
+	font             string
+	ttfFonts         map[string]string
+	translate        func(string) string
+	fontSize         float64
+	singleSpace      float64
+	lineHeight       float64
+	header           []headerToken
+	headerPosition   string
+	chapterPosition  string
+	showTitlePage    bool
+	titlePage        int
+	firstBodyPage    int
+	includeTOC       bool
+	anonymous        bool
+	bylinePrefix     string
+	novelPrefix      string
+	toc              []tocEntry
+	document         parser.Document
+	pdf              *gofpdf.Fpdf
+}
+
+// Options lists the options accepted by New.
+var Options = append(
+	[]renderers.OptionSpec{
+		{
+			Name:        "pageSize",
+			Default:     "Letter",
+			Description: "Page size: Letter, Legal, A3, A4 or A5",
+		},
+		{
+			Name:        "pageOrientation",
+			Default:     "P",
+			Description: "Page orientation: P/Portrait or L/Landscape",
+		},
+		{
+			Name:        "scenePageBreak",
+			Default:     "false",
+			Description: "Start each scene on a new page",
+		},
+		{
+			Name:        "numberScenes",
+			Default:     "false",
+			Description: "Number each scene within its chapter, as in 1.2",
+		},
+		{
+			Name:        "firstLineIndent",
+			Default:     "true",
+			Description: "Indent the first paragraph after a heading or break",
+		},
+		{
+			Name:        "font",
+			Default:     "Courier",
+			Description: "Font: Courier, Times, Arial or Helvetica",
+		},
+		{
+			Name:        "ttfFont",
+			Default:     "",
+			Description: "TrueType font file to use instead of font",
+		},
+		{
+			Name:        "ttfBoldFont",
+			Default:     "",
+			Description: "TrueType font file for bold text",
+		},
+		{
+			Name:        "ttfItalicFont",
+			Default:     "",
+			Description: "TrueType font file for italic text",
+		},
+		{
+			Name:        "ttfBoldItalicFont",
+			Default:     "",
+			Description: "TrueType font file for bold italic text",
+		},
+		{
+			Name:        "fontSize",
+			Default:     "12",
+			Description: "Font size in points",
+		},
+		{
+			Name:        "lineSpacing",
+			Default:     "2",
+			Description: "Line spacing as a multiple of the font size",
+		},
+		{
+			Name:        "headerFormat",
+			Default:     defaultHeaderFormat,
+			Description: "Page header, using {author}, {title} and {page}",
+		},
+		{
+			Name:        "headerPosition",
+			Default:     "top-right",
+			Description: "Header at top-right, top-center or bottom-center",
+		},
+		{
+			Name:        "chapterTitlePosition",
+			Default:     "center",
+			Description: "Chapter titles at center, third or top of the page",
+		},
+		{
+			Name:        "titlePage",
+			Default:     "true",
+			Description: "Start with a cover and title page",
+		},
+		{
+			Name:        "includeTOC",
+			Default:     "false",
+			Description: "Include a table of contents after the title page",
+		},
+		{
+			Name:        "anonymous",
+			Default:     "false",
+			Description: "Leave the author's name out for blind submissions",
+		},
+		{
+			Name:        "bylinePrefix",
+			Default:     "by",
+			Description: "Text before the author's name in the byline",
+		},
+		{
+			Name:        "novelPrefix",
+			Default:     "a novel",
+			Description: "Text before the byline of a novel",
+		},
+		{
+			Name:        "allowHyphenation",
+			Default:     "false",
+			Description: "Break long words at their \\- soft hyphens",
+		},
+		{
+			Name:        "endMarker",
+			Default:     "auto",
+			Description: "Mark the end of the story, by default only if short",
+		},
+		{
+			Name:        "endMarkerText",
+			Default:     "# # #",
+			Description: "Text of the end marker",
+		},
+		{
+			Name:        "dropCap",
+			Default:     "false",
+			Description: "Enlarge the first letter of each chapter",
+		},
+	},
+	append(
+		renderers.NewSceneSeparator("#").Options(),
+		util.LabelOptions...,
+	)...,
+)
+
+func init() {
+	renderers.Register("pdf", New, Options...)
 }
 
 // New creates a new Renderer given a document and options.
@@ -52,6 +227,27 @@ func New(
 ) (renderers.Renderer, error) {
 	pageSize := "Letter"
 	pageOrientation := "P"
+	sceneBreak := renderers.NewSceneSeparator("#")
+	scenePageBreak := false
+	numberScenes := false
+	indentFirst := true
+	font := "Courier"
+	ttfFonts := map[string]string{}
+	fontSize := 12.0
+	lineSpacing := 2.0
+	headerFormat := defaultHeaderFormat
+	headerPosition := "top-right"
+	chapterPosition := "center"
+	showTitlePage := true
+	includeTOC := false
+	anonymous := false
+	bylinePrefix := "by"
+	novelPrefix := "a novel"
+	allowHyphenation := false
+	endMarker := document.Type == parser.ShortStory
+	endMarkerText := "# # #"
+	dropCap := false
+	labels := util.DefaultLabels
 
 	for k, v := range options {
 		switch k {
@@ -59,28 +255,203 @@ func New(
 			pageSize = v
 		case "pageOrientation":
 			pageOrientation = v
+		case "sceneBreak", "sceneBreakAlignment":
+			if err := sceneBreak.Set(k, v); err != nil {
+				return nil, err
+			}
+		case "scenePageBreak":
+			scenePageBreak = util.ArgIsTrue(v)
+		case "numberScenes":
+			numberScenes = util.ArgIsTrue(v)
+		case "firstLineIndent":
+			indentFirst = util.ArgIsTrue(v)
+		case "font":
+			family, ok := fontFamilies[strings.ToLower(v)]
+			if !ok {
+				return nil, fmt.Errorf("Unsupported PDF font %s", v)
+			}
+			font = family
+		case "ttfFont", "ttfBoldFont", "ttfItalicFont", "ttfBoldItalicFont":
+			if v != "" {
+				ttfFonts[ttfStyles[k]] = v
+			}
+		case "fontSize":
+			size, err := strconv.ParseFloat(v, 64)
+			if err != nil || size <= 0 {
+				return nil, fmt.Errorf("Invalid PDF font size %s", v)
+			}
+			fontSize = size
+		case "lineSpacing":
+			spacing, err := strconv.ParseFloat(v, 64)
+			if err != nil || spacing <= 0 {
+				return nil, fmt.Errorf("Invalid PDF line spacing %s", v)
+			}
+			lineSpacing = spacing
+		case "headerFormat":
+			headerFormat = v
+		case "headerPosition":
+			if !headerPositions[v] {
+				return nil, fmt.Errorf("Invalid PDF header position %s", v)
+			}
+			headerPosition = v
+		case "chapterTitlePosition":
+			if !chapterPositions[v] {
+				return nil, fmt.Errorf(
+					"Invalid PDF chapter title position %s",
+					v,
+				)
+			}
+			chapterPosition = v
+		case "titlePage":
+			showTitlePage = util.ArgIsTrue(v)
+		case "includeTOC":
+			includeTOC = util.ArgIsTrue(v)
+		case "anonymous":
+			anonymous = util.ArgIsTrue(v)
+		case "bylinePrefix":
+			bylinePrefix = v
+		case "novelPrefix":
+			novelPrefix = v
+		case "allowHyphenation":
+			allowHyphenation = util.ArgIsTrue(v)
+		case "endMarker":
+			if v != "auto" {
+				endMarker = util.ArgIsTrue(v)
+			}
+		case "endMarkerText":
+			endMarkerText = v
+		case "dropCap":
+			dropCap = util.ArgIsTrue(v)
+		case "partLabel", "chapterLabel", "prologueLabel",
+			"numberStyle", "partNumberStyle", "labelSeparator":
+			if err := labels.Set(k, v); err != nil {
+				return nil, err
+			}
 		default:
 			return nil, fmt.Errorf("Invalid PDF option %s", k)
 		}
 	}
 
+	// A TrueType font takes the place of whichever core font was
+	// chosen, and the regular style is needed for the others to fall
+	// back on.
+	if len(ttfFonts) != 0 {
+		if ttfFonts[""] == "" {
+			return nil, errors.New("Missing ttfFont for TrueType styles")
+		}
+		font = ttfFamily
+	}
+
+	header, err := parseHeaderFormat(headerFormat)
+	if err != nil {
+		return nil, err
+	}
+	if anonymous {
+		header = anonymizeHeader(header)
+	}
+
 	return &Renderer{
-		pageSize:        pageSize,
-		pageOrientation: pageOrientation,
-		document:        document,
+		pageSize:         pageSize,
+		pageOrientation:  pageOrientation,
+		sceneBreak:       sceneBreak,
+		scenePageBreak:   scenePageBreak,
+		numberScenes:     numberScenes,
+		indentFirst:      indentFirst,
+		font:             font,
+		ttfFonts:         ttfFonts,
+		fontSize:         fontSize,
+		singleSpace:      fontSize * 1.15,
+		lineHeight:       fontSize * lineSpacing,
+		header:           header,
+		headerPosition:   headerPosition,
+		chapterPosition:  chapterPosition,
+		showTitlePage:    showTitlePage,
+		includeTOC:       includeTOC,
+		anonymous:        anonymous,
+		bylinePrefix:     bylinePrefix,
+		novelPrefix:      novelPrefix,
+		allowHyphenation: allowHyphenation,
+		endMarker:        endMarker,
+		endMarkerText:    endMarkerText,
+		dropCap:          dropCap,
+		labels:           labels,
+		document:         document,
 	}, nil
 }
 
 // Render writes the requested document out to the specified io.Writer
 // as a PDF file formatted in manuscript format.
 func (r *Renderer) Render(fout io.Writer) error {
+	if err := r.checkFonts(); err != nil {
+		return err
+	}
+	r.setEncoding()
+	if err := r.checkCharacters(); err != nil {
+		return err
+	}
+	if r.document.CoverImage != "" {
+		if _, err := os.Stat(r.document.CoverImage); err != nil {
+			return fmt.Errorf("Invalid cover image %s", r.document.CoverImage)
+		}
+	}
+	for _, image := range r.document.Images() {
+		if _, err := os.Stat(image.Path); err != nil {
+			return fmt.Errorf("Invalid image %s", image.Path)
+		}
+	}
+
+	var toc []tocEntry
+	if r.includeTOC && !r.startsOnTitlePage() {
+		// We can't know what page each part and chapter lands on until
+		// the story has been laid out, so we lay it out once without a
+		// table of contents just to find out.  Page numbers count from
+		// the first page of prose, so adding the table of contents in
+		// front of it doesn't change them.
+		r.layout(nil)
+		toc = r.toc
+	}
+
+	r.layout(toc)
+	return r.pdf.Output(fout)
+}
+
+func (r *Renderer) layout(toc []tocEntry) {
 	r.pdf = gofpdf.New(r.pageOrientation, "pt", r.pageSize, "")
 	r.pdf.SetMargins(ptsPerInch, ptsPerInch, ptsPerInch)
 	r.pdf.SetAutoPageBreak(true, ptsPerInch)
 	r.pdf.SetHeaderFunc(r.writeHeader)
-	r.pdf.AddPage()
+	r.pdf.SetFooterFunc(r.writeFooter)
+	r.addFonts()
+	r.firstBodyPage = 0
+	r.titlePage = 0
+	r.toc = []tocEntry{}
 
-	r.writeTitle()
+	if r.showTitlePage {
+		if r.document.CoverImage != "" {
+			r.writeCover()
+		}
+
+		r.pdf.AddPage()
+		r.titlePage = r.pdf.PageNo()
+		r.writeTitle()
+	}
+
+	if len(r.document.Dedication) != 0 {
+		r.writeDedication()
+	}
+
+	if len(toc) != 0 {
+		r.writeTOC(toc)
+	}
+
+	// Without a title page to start on, a story that opens without a
+	// part or chapter heading needs a page of its own, and that page
+	// is the first one numbered.
+	if !r.showTitlePage && r.opensWithoutHeading() {
+		r.firstBodyPage = r.pdf.PageNo() + 1
+		r.pdf.AddPage()
+		r.pdf.SetX(2 * ptsPerInch)
+	}
 
 	firstPart := true
 	for _, p := range r.document.Parts {
@@ -88,61 +459,121 @@ func (r *Renderer) Render(fout io.Writer) error {
 		firstPart = false
 	}
 
-	return r.pdf.Output(fout)
+	if r.endMarker {
+		r.writeEndMarker()
+	}
+
+	if len(r.document.AfterMatter) != 0 {
+		r.writeAfterword()
+	}
+
+	// Now that we know where the prose starts, the table of contents
+	// entries can be given their actual page numbers.
+	for i := range r.toc {
+		r.toc[i].page -= r.firstBodyPage - 1
+	}
+}
+
+// writeCover places the cover image on a page of its own, stretched to
+// fill the whole page.
+func (r *Renderer) writeCover() {
+	pdf := r.pdf
+	pdf.AddPage()
+
+	w, h := pdf.GetPageSize()
+	pdf.ImageOptions(
+		r.document.CoverImage,
+		0,
+		0,
+		w,
+		h,
+		false,
+		gofpdf.ImageOptions{ReadDpi: true},
+		0,
+		"",
+	)
 }
 
 func (r *Renderer) writeTitle() {
 	pdf, document := r.pdf, r.document
-	pdf.SetFont(fontFamily, "", fontSize)
+	pdf.SetFont(r.font, "", r.fontSize)
 	pdf.SetXY(ptsPerInch, ptsPerInch)
 
 	authorBlockLines := []string{}
-	if document.Author.Name != "" {
-		authorBlockLines = append(authorBlockLines, document.Author.Name)
-	}
-	if len(document.Author.Address) != 0 {
-		authorBlockLines = append(authorBlockLines, document.Author.Address...)
-	}
-	if document.Author.PhoneNumber != "" {
-		authorBlockLines = append(authorBlockLines, document.Author.PhoneNumber)
-	}
-	if document.Author.EmailAddress != "" {
-		authorBlockLines = append(
-			authorBlockLines,
-			document.Author.EmailAddress,
-		)
+	for i, author := range document.Authors() {
+		// Each co-author's contact information follows the primary
+		// author's, separated by a blank line.
+		if i != 0 && author.Name != "" {
+			authorBlockLines = append(authorBlockLines, "")
+		}
+		if author.Name != "" {
+			authorBlockLines = append(authorBlockLines, author.Name)
+		}
+		if len(author.Address) != 0 {
+			authorBlockLines = append(authorBlockLines, author.Address...)
+		}
+		if author.PhoneNumber != "" {
+			authorBlockLines = append(authorBlockLines, author.PhoneNumber)
+		}
+		if author.EmailAddress != "" {
+			authorBlockLines = append(authorBlockLines, author.EmailAddress)
+		}
+		if author.Website != "" {
+			authorBlockLines = append(authorBlockLines, author.Website)
+		}
+		authorBlockLines = append(authorBlockLines, author.SocialLinks...)
+		if len(author.ProfessionalOrgs) != 0 {
+			authorBlockLines = append(authorBlockLines, "")
+			authorBlockLines = append(
+				authorBlockLines,
+				author.ProfessionalOrgs...,
+			)
+		}
 	}
-	if len(document.Author.ProfessionalOrgs) != 0 {
-		authorBlockLines = append(authorBlockLines, "")
-		authorBlockLines = append(
-			authorBlockLines,
-			document.Author.ProfessionalOrgs...,
+	// Blind submissions leave out everything that could identify the
+	// author, byline included.
+	if !r.anonymous {
+		pdf.Write(
+			r.singleSpace,
+			r.encode(strings.Join(authorBlockLines, "\n")),
 		)
 	}
-	pdf.Write(singleSpace, strings.Join(authorBlockLines, "\n"))
 
 	w, h := pdf.GetPageSize()
-	byline := "by " + document.Author.Byline
+	byline := strings.TrimSpace(r.bylinePrefix + " " + document.Byline())
+	if r.anonymous {
+		byline = ""
+	}
 	if document.Type == parser.Novel {
-		byline = "a novel " + byline
+		byline = strings.TrimSpace(r.novelPrefix + " " + byline)
 	}
 
 	pdf.SetXY(ptsPerInch, h/2)
 	pdf.WriteAligned(
 		w-2*ptsPerInch,
-		singleSpace,
-		document.Title,
+		r.singleSpace,
+		r.encode(document.Title),
 		"C",
 	)
 
-	pdf.SetXY(ptsPerInch, h/2+doubleSpace)
+	pdf.SetXY(ptsPerInch, h/2+r.lineHeight)
 	pdf.WriteAligned(
 		w-2*ptsPerInch,
-		singleSpace,
-		byline,
+		r.singleSpace,
+		r.encode(byline),
 		"C",
 	)
 
+	if !document.Date.IsZero() {
+		pdf.SetXY(ptsPerInch, h/2+2*r.lineHeight)
+		pdf.WriteAligned(
+			w-2*ptsPerInch,
+			r.singleSpace,
+			document.Date.Format("January 2, 2006"),
+			"C",
+		)
+	}
+
 	words := "about " + humanize.Comma(document.WordCount()) + " words"
 	if document.Type == parser.ShortStory {
 		pdf.SetXY(ptsPerInch, ptsPerInch)
@@ -155,16 +586,16 @@ func (r *Renderer) writeTitle() {
 			// whatever reason causes it to line break even for very short
 			// text.
 			w-ptsPerInch-10,
-			singleSpace,
+			r.singleSpace,
 			words,
 			"R",
 		)
-		pdf.SetXY(2*ptsPerInch, h/2+4*doubleSpace)
+		pdf.SetXY(2*ptsPerInch, h/2+4*r.lineHeight)
 	} else if document.Type == parser.Novel {
-		pdf.SetXY(ptsPerInch, h-ptsPerInch-singleSpace)
+		pdf.SetXY(ptsPerInch, h-ptsPerInch-r.singleSpace)
 		pdf.WriteAligned(
 			w-2*ptsPerInch,
-			singleSpace,
+			r.singleSpace,
 			words,
 			"C",
 		)
@@ -172,21 +603,52 @@ func (r *Renderer) writeTitle() {
 	}
 }
 
+// writeDedication puts the dedication on a page of its own after the
+// title page, or just beneath the title if the story starts on the
+// title page.
+func (r *Renderer) writeDedication() {
+	pdf := r.pdf
+	w, h := pdf.GetPageSize()
+
+	inline := r.startsOnTitlePage()
+	if !inline {
+		pdf.AddPage()
+		pdf.SetY(h / 3)
+	}
+
+	pdf.SetFont(r.font, "I", r.fontSize)
+	for _, line := range r.document.Dedication {
+		pdf.SetX(ptsPerInch)
+		pdf.WriteAligned(w-2*ptsPerInch, r.singleSpace, r.encode(line), "C")
+		pdf.Write(r.singleSpace, "\n")
+	}
+	pdf.SetFont(r.font, "", r.fontSize)
+
+	if inline {
+		pdf.Write(r.lineHeight, "\n")
+		pdf.SetX(2 * ptsPerInch)
+	}
+}
+
 func (r *Renderer) renderPart(part parser.Part, firstInDocument bool) {
 	pdf := r.pdf
 	w, h := pdf.GetPageSize()
 	if !part.Anonymous {
-		text := util.PartLabel(part.Number, part.Title)
+		text := r.encode(r.labels.PartLabel(part.Number, part.Title))
 		pdf.AddPage()
-		pdf.SetFont(fontFamily, "", fontSize)
-		pdf.SetXY(ptsPerInch, h/2-2*doubleSpace)
-		pdf.Bookmark(text, 0, -1)
-		pdf.WriteAligned(
-			w-2*ptsPerInch,
-			singleSpace,
-			text,
-			"C",
-		)
+		pdf.SetFont(r.font, "", r.fontSize)
+		pdf.Bookmark(util.OneLine(text), 0, -1)
+		r.addTOCEntry(0, util.OneLine(text))
+		for i, line := range strings.Split(text, "\n") {
+			y := h/2 - 2*r.lineHeight + float64(i)*r.lineHeight
+			pdf.SetXY(ptsPerInch, y)
+			pdf.WriteAligned(
+				w-2*ptsPerInch,
+				r.singleSpace,
+				line,
+				"C",
+			)
+		}
 		pdf.SetXY(2*ptsPerInch, h/2)
 	}
 
@@ -209,130 +671,612 @@ func (r *Renderer) renderChapter(
 	pdf := r.pdf
 	w, h := pdf.GetPageSize()
 
+	startsPage := !chapter.Anonymous && !firstInPart
+	if r.firstBodyPage == 0 {
+		// Page numbers count from the first page of prose, so that the
+		// title page and any part pages before it aren't numbered.
+		r.firstBodyPage = pdf.PageNo()
+		if startsPage {
+			r.firstBodyPage++
+		}
+	}
+
+	if startsPage {
+		pdf.AddPage()
+	}
 	if !chapter.Anonymous {
-		if !firstInPart {
-			pdf.AddPage()
+		// A chapter that opens a part shares the part's page, so it
+		// stays centered beneath the part title.
+		y := h / 2
+		if startsPage {
+			y = r.chapterTitleY()
 		}
-		pdf.SetFont(fontFamily, "", fontSize)
-		pdf.SetXY(ptsPerInch, h/2)
+		pdf.SetFont(r.font, "", r.fontSize)
+		pdf.SetXY(ptsPerInch, y)
 
 		bookmarkText := ""
 		labelText := ""
 		if chapter.Prologue {
-			bookmarkText = util.PrologueLabel(chapter.Title)
-			labelText = "Prologue"
+			bookmarkText = r.labels.PrologueLabel(chapter.Title)
+			labelText = r.labels.Prologue
 		} else {
-			bookmarkText = util.ChapterLabel(chapter.Number, chapter.Title)
-			labelText = fmt.Sprintf("Chapter %d", chapter.Number)
+			bookmarkText = r.labels.ChapterLabel(chapter.Number, chapter.Title)
+			labelText = r.labels.ChapterHeading(chapter.Number)
 		}
 
+		bookmarkText = r.encode(util.OneLine(bookmarkText))
 		pdf.Bookmark(bookmarkText, bookmarkLevel, -1)
+		r.addTOCEntry(bookmarkLevel, bookmarkText)
 		pdf.WriteAligned(
 			w-2*ptsPerInch,
-			singleSpace,
-			labelText,
+			r.singleSpace,
+			r.encode(labelText),
 			"C",
 		)
 
-		newY := h/2 + 2*doubleSpace
+		newY := y + 2*r.lineHeight
 		if chapter.Title != "" {
-			pdf.SetXY(ptsPerInch, h/2+doubleSpace)
+			pdf.SetXY(ptsPerInch, y+r.lineHeight)
 			pdf.WriteAligned(
 				w-2*ptsPerInch,
-				singleSpace,
-				chapter.Title,
+				r.singleSpace,
+				r.encode(chapter.Title),
 				"C",
 			)
-			newY += doubleSpace
+			newY += r.lineHeight
 		}
 		pdf.SetXY(2*ptsPerInch, newY)
 	}
 
-	for _, s := range chapter.Scenes {
-		r.renderScene(s)
+	if chapter.Epigraph != nil {
+		r.writeEpigraph(*chapter.Epigraph)
+	}
+
+	// As in the HTML renderer, the drop cap goes on the chapter's first
+	// paragraph of prose.
+	r.opening = r.dropCap
+	defer func() { r.opening = false }()
+
+	for i, s := range chapter.Scenes {
+		if i != 0 && r.scenePageBreak {
+			pdf.AddPage()
+			pdf.SetX(2 * ptsPerInch)
+		}
+		// The label on a scene break goes just after the break, which
+		// puts it at the top of the page when scenes start new pages.
+		if i != 0 && chapter.Scenes[i-1].BreakLabel != "" {
+			r.writeSceneLabel(chapter.Scenes[i-1].BreakLabel)
+		}
+
+		number := ""
+		if r.numberScenes {
+			number = util.SceneNumber(chapter, i)
+		}
+		r.renderScene(s, number)
+
+		// As in every other renderer, there's no break after the last
+		// scene, even if the story has a stray @scene at the end of
+		// the chapter.  When each scene starts a new page, the page
+		// break is all the separation a scene needs.
+		if i != len(chapter.Scenes)-1 && !r.scenePageBreak {
+			r.writeSceneBreak()
+		}
+	}
+}
+
+// chapterTitleY returns how far down the page a chapter's heading
+// starts when the chapter begins a page of its own.  Manuscript format
+// traditionally centers it, but many publishers ask for it a third of
+// the way down instead.
+func (r *Renderer) chapterTitleY() float64 {
+	_, h := r.pdf.GetPageSize()
+	switch r.chapterPosition {
+	case "third":
+		return h / 3
+	case "top":
+		return ptsPerInch
 	}
+	return h / 2
 }
 
-func (r *Renderer) renderScene(scene parser.Scene) {
+// writeAfterword starts the afterword on a fresh page, headed the same
+// way as a chapter.
+func (r *Renderer) writeAfterword() {
 	pdf := r.pdf
 	w, _ := pdf.GetPageSize()
 
-	for _, p := range scene.Paragraphs {
+	pdf.AddPage()
+	pdf.SetFont(r.font, "", r.fontSize)
+	y := r.chapterTitleY()
+	pdf.SetXY(ptsPerInch, y)
+	pdf.Bookmark("Afterword", 0, -1)
+	r.addTOCEntry(0, "Afterword")
+	pdf.WriteAligned(w-2*ptsPerInch, r.singleSpace, "Afterword", "C")
+	pdf.SetXY(2*ptsPerInch, y+2*r.lineHeight)
+
+	r.unindented = !r.indentFirst
+	for _, p := range r.document.AfterMatter {
 		r.renderParagraph(p)
 	}
+}
+
+func (r *Renderer) writeEpigraph(epigraph parser.Epigraph) {
+	pdf := r.pdf
+	w, _ := pdf.GetPageSize()
+
+	// See writeHeader for an explanation of the width used for
+	// right-aligned text.
+	pdf.SetFont(r.font, "I", r.fontSize)
+	pdf.SetX(ptsPerInch)
+	pdf.WriteAligned(
+		w-ptsPerInch-10,
+		r.lineHeight,
+		r.encode(epigraph.Text),
+		"R",
+	)
+	pdf.Write(r.lineHeight, "\n")
+
+	if epigraph.Attribution != "" {
+		pdf.SetFont(r.font, "", r.fontSize)
+		pdf.WriteAligned(
+			w-ptsPerInch-10,
+			r.lineHeight,
+			r.encode("-- "+epigraph.Attribution),
+			"R",
+		)
+		pdf.Write(r.lineHeight, "\n")
+	}
+
+	pdf.Write(r.lineHeight, "\n")
+	pdf.SetX(2 * ptsPerInch)
+}
+
+// renderScene writes a single scene, headed by the given scene number
+// unless it's empty.
+func (r *Renderer) renderScene(scene parser.Scene, number string) {
+	pdf := r.pdf
+	w, _ := pdf.GetPageSize()
+
+	if number != "" {
+		// See writeSceneBreak for why we need to write a space first.
+		pdf.SetFont(r.font, "", r.fontSize*0.8)
+		pdf.Write(r.singleSpace, " ")
+		pdf.WriteAligned(w-2*ptsPerInch, r.lineHeight, number, "C")
+		pdf.Write(r.lineHeight, "\n")
+		pdf.SetFont(r.font, "", r.fontSize)
+		pdf.SetX(2 * ptsPerInch)
+	}
+
+	// Unless firstLineIndent is on, the first paragraph of the scene and
+	// of each titled section in it starts at the margin, as in print.
+	r.unindented = !r.indentFirst
+	for _, s := range scene.Sections {
+		r.renderSection(s)
+	}
+}
+
+func (r *Renderer) writeSceneBreak() {
+	pdf := r.pdf
+	w, _ := pdf.GetPageSize()
 
-	if scene.EndsWithSceneBreak {
+	if r.sceneBreak.Blank() {
+		pdf.Write(r.lineHeight, "\n")
+		pdf.SetX(2 * ptsPerInch)
+	} else {
 		// This is another addition I don't fully understand.  Without
 		// this line, Using WriteAligned at the very beginning of a
 		// page seems to cause some bizarre linebreak behavior in the
 		// header, but if I write a single space before the hash mark,
 		// which doesn't seem to visibly affect the rendering, the
 		// problem goes away.
-		pdf.Write(singleSpace, " ")
-		pdf.WriteAligned(w-2*ptsPerInch, doubleSpace, "#", "C")
-		pdf.Write(doubleSpace, "\n")
+		pdf.Write(r.singleSpace, " ")
+
+		// See writeHeader for an explanation of the width used for
+		// right-aligned text.
+		width, align := w-2*ptsPerInch, "C"
+		switch r.sceneBreak.Alignment {
+		case parser.LeftAlignment:
+			pdf.SetX(ptsPerInch)
+			align = "L"
+		case parser.RightAlignment:
+			width, align = w-ptsPerInch-10, "R"
+		}
+		glyph := r.encode(r.sceneBreak.Glyph)
+		pdf.WriteAligned(width, r.lineHeight, glyph, align)
+		pdf.Write(r.lineHeight, "\n")
+		pdf.SetX(2 * ptsPerInch)
+	}
+}
+
+func (r *Renderer) writeSceneLabel(label string) {
+	pdf := r.pdf
+	w, _ := pdf.GetPageSize()
+
+	// See writeSceneBreak for why we need to write a space first.
+	pdf.SetFont(r.font, "I", r.fontSize)
+	pdf.Write(r.singleSpace, " ")
+	pdf.WriteAligned(w-2*ptsPerInch, r.lineHeight, r.encode(label), "C")
+	pdf.Write(r.lineHeight, "\n")
+	pdf.SetFont(r.font, "", r.fontSize)
+	pdf.SetX(2 * ptsPerInch)
+}
+
+// writeEndMarker centers the end marker on the line after the last
+// paragraph of the story.
+func (r *Renderer) writeEndMarker() {
+	pdf := r.pdf
+	w, _ := pdf.GetPageSize()
+
+	// See writeSceneBreak for why we need to write a space first.
+	pdf.SetFont(r.font, "", r.fontSize)
+	pdf.Write(r.singleSpace, " ")
+	marker := r.encode(r.endMarkerText)
+	pdf.WriteAligned(w-2*ptsPerInch, r.lineHeight, marker, "C")
+	pdf.Write(r.lineHeight, "\n")
+	pdf.SetX(2 * ptsPerInch)
+}
+
+func (r *Renderer) renderSection(section parser.Section) {
+	pdf := r.pdf
+	w, _ := pdf.GetPageSize()
+
+	if section.Title != "" {
+		// See writeSceneBreak for why we need to write a space first.
+		pdf.SetFont(r.font, "B", r.fontSize)
+		pdf.Write(r.singleSpace, " ")
+		title := r.encode(section.Title)
+		pdf.WriteAligned(w-2*ptsPerInch, r.lineHeight, title, "C")
+		pdf.Write(r.lineHeight, "\n")
 		pdf.SetX(2 * ptsPerInch)
+		r.unindented = !r.indentFirst
+	}
+
+	for _, p := range section.Paragraphs {
+		r.renderParagraph(p)
 	}
 }
 
 func (r *Renderer) renderParagraph(paragraph parser.Paragraph) {
 	pdf := r.pdf
 
-	for _, element := range paragraph.Text {
-		switch e := element.(type) {
-		case parser.PlainText:
-			pdf.SetFont(fontFamily, "", fontSize)
-			pdf.Write(doubleSpace, string(e))
+	if !paragraph.RenderedBy("pdf") {
+		return
+	}
+
+	if block, ok := paragraph.Conditional(); ok {
+		for _, p := range block.Paragraphs {
+			r.renderParagraph(p)
+		}
+		return
+	}
+
+	if spoiler, ok := paragraph.Spoiler(); ok {
+		r.writeSpoiler(spoiler)
+		return
+	}
 
-		case parser.ItalicText:
-			pdf.SetFont(fontFamily, "U", fontSize)
-			pdf.Write(doubleSpace, string(e))
+	unindented := r.unindented
+	r.unindented = false
 
-		case parser.BoldText:
-			pdf.SetFont(fontFamily, "B", fontSize)
-			pdf.Write(doubleSpace, string(e))
+	if verse, ok := paragraph.Verse(); ok {
+		for _, line := range verse.Lines {
+			r.writeElements(line)
+			pdf.Write(r.lineHeight, "\n")
+			pdf.SetX(2 * ptsPerInch)
+		}
+		return
+	}
 
-		case parser.BoldItalicText:
-			pdf.SetFont(fontFamily, "BU", fontSize)
-			pdf.Write(doubleSpace, string(e))
+	if image, ok := paragraph.Image(); ok {
+		r.writeImage(image)
+		return
+	}
 
+	// There's no markup to pass a raw block through to in a PDF.
+	if _, ok := paragraph.Raw(); ok {
+		return
+	}
+
+	dropCap := r.opening
+	r.opening = false
+
+	elements := paragraph.Text
+	if paragraph.Alignment != parser.DefaultAlignment {
+		// The enlarged letter would throw off the width that aligned
+		// paragraphs are placed by, so they're left as they are.
+		r.alignParagraph(paragraph)
+	} else {
+		if unindented {
+			pdf.SetX(ptsPerInch)
+		}
+		if dropCap {
+			if first, rest, ok := util.SplitFirstLetter(elements); ok {
+				r.writeDropCap(first)
+				elements = rest
+			}
 		}
 	}
 
-	pdf.Write(doubleSpace, "\n")
+	r.writeElements(elements)
+	pdf.Write(r.lineHeight, "\n")
 	pdf.SetX(2 * ptsPerInch)
 }
 
-func (r *Renderer) writeHeader() {
-	pdf, document := r.pdf, r.document
-	if pdf.PageNo() == 1 {
+// A page can't hide anything, so a spoiler is set apart as an aside
+// in smaller type, like a footnote, under an italic heading.
+func (r *Renderer) writeSpoiler(spoiler parser.SpoilerBlock) {
+	pdf := r.pdf
+	fontSize, lineHeight := r.fontSize, r.lineHeight
+	r.fontSize, r.lineHeight = fontSize*0.8, lineHeight*0.8
+	defer func() {
+		r.fontSize, r.lineHeight = fontSize, lineHeight
+		pdf.SetFont(r.font, "", r.fontSize)
+	}()
+
+	title := spoiler.Title
+	if title == "" {
+		title = "Spoiler"
+	}
+	pdf.SetX(ptsPerInch)
+	pdf.SetFont(r.font, "I", r.fontSize)
+	r.writeText(title)
+	pdf.Write(r.lineHeight, "\n")
+	pdf.SetX(2 * ptsPerInch)
+
+	for _, p := range spoiler.Paragraphs {
+		r.renderParagraph(p)
+	}
+}
+
+// writeDropCap writes the first letter of a chapter at twice the usual
+// size.  gofpdf has no way to wrap text around a letter that spans
+// several lines, so this just sits on the first line as a raised cap,
+// and a struck-through letter is written without its line.
+func (r *Renderer) writeDropCap(elements []parser.DocumentElement) {
+	for _, element := range elements {
+		if e, ok := element.(parser.StrikethroughText); ok {
+			element = e.Text
+		}
+
+		style, text := r.fontStyle(element)
+		r.pdf.SetFont(r.font, style, r.fontSize*2)
+		r.pdf.Write(r.lineHeight, r.encode(text))
+	}
+}
+
+// writeImage scales an image to fit the text column, and centers it
+// with its caption beneath it.  Images are never split across pages,
+// so one that won't fit in what's left of the page goes on the next.
+func (r *Renderer) writeImage(image parser.Image) {
+	pdf := r.pdf
+	w, h := pdf.GetPageSize()
+
+	options := gofpdf.ImageOptions{ReadDpi: true}
+	info := pdf.RegisterImageOptions(image.Path, options)
+	if info == nil || info.Width() == 0 {
+		// gofpdf keeps track of the error, and Output will return it.
 		return
 	}
 
-	pageNumber := pdf.PageNo()
-	if document.Type == parser.Novel {
-		pageNumber--
+	captionHeight := 0.0
+	if image.Caption != "" {
+		captionHeight = r.lineHeight
 	}
 
-	w, _ := pdf.GetPageSize()
-	pdf.SetXY(ptsPerInch, ptsPerInch)
-	pdf.WriteAligned(
-		// This calculation continues to baffle me, and I suspect that
-		// there's something screwy going on in the gofpdf library.
-		// For some reason using what seems like the appropriate width
-		// (w - 2 * ptsPerInch) makes the header render too far away
-		// from the right margin, but leaving out the -10 factor for
-		// whatever reason causes it to line break even for very short
-		// text.
-		w-ptsPerInch-10,
-		singleSpace,
-		fmt.Sprintf(
-			"%s / %s / %d",
-			document.Author.ShortName,
-			document.ShortTitle,
-			pageNumber,
-		),
-		"R",
+	width := w - 2*ptsPerInch
+	height := width * info.Height() / info.Width()
+	maxHeight := h - 2*ptsPerInch - 2*r.fontSize - captionHeight
+	if height > maxHeight {
+		width *= maxHeight / height
+		height = maxHeight
+	}
+
+	if pdf.GetY()+height+captionHeight > h-ptsPerInch {
+		pdf.AddPage()
+	}
+
+	y := pdf.GetY()
+	pdf.ImageOptions(
+		image.Path,
+		ptsPerInch+(w-2*ptsPerInch-width)/2,
+		y,
+		width,
+		height,
+		false,
+		options,
+		0,
+		"",
 	)
-	pdf.SetXY(ptsPerInch, ptsPerInch+doubleSpace)
+	pdf.SetXY(ptsPerInch, y+height)
+
+	if image.Caption != "" {
+		pdf.SetFont(r.font, "I", r.fontSize)
+		caption := r.encode(image.Caption)
+		pdf.WriteAligned(w-2*ptsPerInch, r.lineHeight, caption, "C")
+	}
+	pdf.Write(r.lineHeight, "\n")
+	pdf.SetX(2 * ptsPerInch)
+}
+
+// alignParagraph moves to where an aligned paragraph should start.
+// Centering and right-aligning only work for paragraphs that fit on a
+// single line, so longer ones are just lined up on the left.
+func (r *Renderer) alignParagraph(paragraph parser.Paragraph) {
+	pdf := r.pdf
+	w, _ := pdf.GetPageSize()
+
+	textWidth := 0.0
+	for _, element := range paragraph.Text {
+		style, text := "", ""
+		switch e := element.(type) {
+		case parser.StrikethroughText:
+			style, text = r.fontStyle(e.Text)
+		case parser.Footnote:
+			text = " (" + string(e) + ")"
+		default:
+			style, text = r.fontStyle(e)
+		}
+		pdf.SetFont(r.font, style, r.fontSize)
+		textWidth += pdf.GetStringWidth(r.encodeText(text))
+	}
+
+	x, space := float64(ptsPerInch), w-2*ptsPerInch-textWidth
+	if space > 0 {
+		switch paragraph.Alignment {
+		case parser.CenterAlignment:
+			x += space / 2
+		case parser.RightAlignment:
+			x += space
+		}
+	}
+	pdf.SetX(x)
+}
+
+func (r *Renderer) writeElements(elements []parser.DocumentElement) {
+	pdf := r.pdf
+
+	for _, element := range elements {
+		switch e := element.(type) {
+		case parser.StrikethroughText:
+			r.writeStrikethrough(e.Text)
+
+		case parser.ColoredText:
+			pdf.SetTextColor(e.RGB())
+			r.writeElements([]parser.DocumentElement{e.Text})
+			pdf.SetTextColor(0, 0, 0)
+
+		case parser.Footnote:
+			pdf.SetFont(r.font, "", r.fontSize)
+			r.writeText(" (" + string(e) + ")")
+
+		default:
+			style, text := r.fontStyle(e)
+			pdf.SetFont(r.font, style, r.fontSize)
+			r.writeText(text)
+		}
+	}
+}
+
+// writeText writes a run of text in the current font.  gofpdf only
+// breaks lines at spaces, so when hyphenation is allowed we break
+// words at their soft hyphens ourselves whenever a word would
+// otherwise run past the right margin.
+func (r *Renderer) writeText(text string) {
+	pdf := r.pdf
+	if !r.allowHyphenation || !strings.ContainsRune(text, parser.SoftHyphen) {
+		pdf.Write(r.lineHeight, r.encodeText(text))
+		return
+	}
+
+	w, _ := pdf.GetPageSize()
+	right := w - ptsPerInch
+	for _, word := range strings.SplitAfter(text, " ") {
+		syllables := strings.Split(word, string(parser.SoftHyphen))
+		for i := range syllables {
+			syllables[i] = r.encode(syllables[i])
+		}
+		for len(syllables) > 1 {
+			whole := strings.TrimRight(strings.Join(syllables, ""), " ")
+			if pdf.GetX()+pdf.GetStringWidth(whole) <= right {
+				break
+			}
+
+			fits := 0
+			for i := 1; i < len(syllables); i++ {
+				prefix := strings.Join(syllables[:i], "") + "-"
+				if pdf.GetX()+pdf.GetStringWidth(prefix) > right {
+					break
+				}
+				fits = i
+			}
+
+			if fits == 0 {
+				// Not even the first syllable fits, so start a new line
+				// and try again from there, unless we're already at
+				// the start of one.
+				if pdf.GetX() <= ptsPerInch {
+					break
+				}
+				pdf.Write(r.lineHeight, "\n")
+				continue
+			}
+
+			pdf.Write(
+				r.lineHeight,
+				strings.Join(syllables[:fits], "")+"-\n",
+			)
+			syllables = syllables[fits:]
+		}
+		pdf.Write(r.lineHeight, strings.Join(syllables, ""))
+	}
+}
+
+func removeSoftHyphens(text string) string {
+	return strings.Replace(text, string(parser.SoftHyphen), "", -1)
+}
+
+// encodeText prepares text to be measured or written out in a single
+// piece, without any hyphenation.  In Windows-1252 a non-breaking space
+// is the single byte 0xA0, and Write only breaks lines at plain spaces,
+// so words joined by one stay together.
+func (r *Renderer) encodeText(text string) string {
+	return r.encode(removeSoftHyphens(text))
+}
+
+// gofpdf doesn't have a strikethrough font style, so instead we write
+// the text one word at a time and draw a line through each word after
+// it's been written.  Going word by word means we always know where
+// the text started, even if Write wraps it onto a new line.
+func (r *Renderer) writeStrikethrough(element parser.DocumentElement) {
+	pdf := r.pdf
+
+	if e, ok := element.(parser.ColoredText); ok {
+		pdf.SetTextColor(e.RGB())
+		defer pdf.SetTextColor(0, 0, 0)
+	}
+
+	style, text := r.fontStyle(element)
+	pdf.SetFont(r.font, style, r.fontSize)
+
+	text = r.encodeText(text)
+	for _, word := range strings.SplitAfter(text, " ") {
+		if word == "" {
+			continue
+		}
+
+		startX, startY := pdf.GetXY()
+		pdf.Write(r.lineHeight, word)
+		endX, endY := pdf.GetXY()
+
+		if endY != startY {
+			startX = ptsPerInch
+		}
+
+		lineY := endY + r.lineHeight/2
+		pdf.Line(startX, lineY, endX, lineY)
+	}
+}
+
+// fontStyle returns the gofpdf font style and raw text for a text
+// element.  Manuscript format calls for italics to be underlined, but
+// given a TrueType italic font, italics are set in it instead.
+// Colored text is set in the same style as the text it holds.
+func (r *Renderer) fontStyle(
+	element parser.DocumentElement,
+) (style, text string) {
+	switch e := element.(type) {
+	case parser.PlainText:
+		return "", string(e)
+	case parser.ItalicText:
+		return r.italicStyle("I", "U"), string(e)
+	case parser.BoldText:
+		return "B", string(e)
+	case parser.BoldItalicText:
+		return r.italicStyle("BI", "BU"), string(e)
+	case parser.UnderlineText:
+		return "U", string(e)
+	case parser.ColoredText:
+		return r.fontStyle(e.Text)
+	}
+	return "", ""
 }
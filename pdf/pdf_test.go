@@ -0,0 +1,93 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package pdf
+
+import (
+	"github.com/bieber/manuscript/parser"
+	"github.com/jung-kurt/gofpdf"
+	"math"
+	"testing"
+)
+
+// newTestRenderer sets up a renderer with a single blank page, ready
+// to write text to.
+func newTestRenderer(t *testing.T, options map[string]string) *Renderer {
+	t.Helper()
+	renderer, err := New(parser.Document{Title: "T"}, options)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	r := renderer.(*Renderer)
+	r.setEncoding()
+	r.pdf = gofpdf.New("P", "pt", "Letter", "")
+	r.pdf.SetMargins(ptsPerInch, ptsPerInch, ptsPerInch)
+	r.pdf.AddPage()
+	r.pdf.SetFont(r.font, "", r.fontSize)
+	return r
+}
+
+func TestHyphenation(t *testing.T) {
+	word := "Donau\u00addampf\u00adschiff\u00adfahrt"
+
+	tests := []struct {
+		allowHyphenation string
+		nextLine         string
+	}{
+		// With eight characters left on the line, only "Donau-" fits,
+		// and the rest of the word goes on the next line.
+		{"true", "dampfschifffahrt"},
+		// Without hyphenation the whole word moves down a line.
+		{"false", "Donaudampfschifffahrt"},
+	}
+
+	for _, test := range tests {
+		r := newTestRenderer(
+			t,
+			map[string]string{"allowHyphenation": test.allowHyphenation},
+		)
+		pdf := r.pdf
+
+		w, _ := pdf.GetPageSize()
+		pdf.SetX(w - ptsPerInch - 8*pdf.GetStringWidth("x"))
+		_, startY := pdf.GetXY()
+
+		r.writeText(word)
+
+		x, y := pdf.GetXY()
+		if y != startY+r.lineHeight {
+			t.Errorf(
+				"allowHyphenation=%s: ended %v below the start, want %v",
+				test.allowHyphenation,
+				y-startY,
+				r.lineHeight,
+			)
+		}
+		want := ptsPerInch + pdf.GetStringWidth(test.nextLine)
+		if math.Abs(x-want) > 0.01 {
+			t.Errorf(
+				"allowHyphenation=%s: ended at x=%v, want %v for %q",
+				test.allowHyphenation,
+				x,
+				want,
+				test.nextLine,
+			)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package pdf
+
+import (
+	"strconv"
+)
+
+// tocEntry is a single part or chapter in the table of contents.
+type tocEntry struct {
+	level int
+	text  string
+	page  int
+}
+
+// startsOnTitlePage checks whether the story's prose begins on the
+// title page, in which case there's nowhere to put a table of
+// contents.
+func (r *Renderer) startsOnTitlePage() bool {
+	return r.showTitlePage && r.opensWithoutHeading()
+}
+
+// opensWithoutHeading checks whether the story's prose comes before
+// any part or chapter heading.
+func (r *Renderer) opensWithoutHeading() bool {
+	parts := r.document.Parts
+	return len(parts) != 0 &&
+		parts[0].Anonymous &&
+		len(parts[0].Chapters) != 0 &&
+		parts[0].Chapters[0].Anonymous
+}
+
+func (r *Renderer) addTOCEntry(level int, text string) {
+	r.toc = append(
+		r.toc,
+		tocEntry{level: level, text: text, page: r.pdf.PageNo()},
+	)
+}
+
+func (r *Renderer) writeTOC(toc []tocEntry) {
+	pdf := r.pdf
+	w, _ := pdf.GetPageSize()
+
+	pdf.AddPage()
+	pdf.SetFont(r.font, "", r.fontSize)
+	pdf.SetXY(ptsPerInch, ptsPerInch)
+	pdf.WriteAligned(w-2*ptsPerInch, r.singleSpace, "Contents", "C")
+	pdf.SetXY(ptsPerInch, ptsPerInch+2*r.lineHeight)
+
+	numberWidth := pdf.GetStringWidth("0000")
+	for _, entry := range toc {
+		indent := float64(entry.level) * ptsPerInch / 2
+
+		// Part pages that come before the first page of prose don't
+		// have a page number to list.
+		page := ""
+		if entry.page > 0 {
+			page = strconv.Itoa(entry.page)
+		}
+
+		pdf.SetX(ptsPerInch + indent)
+		pdf.CellFormat(
+			w-2*ptsPerInch-indent-numberWidth,
+			r.lineHeight,
+			entry.text,
+			"",
+			0,
+			"L",
+			false,
+			0,
+			"",
+		)
+		pdf.CellFormat(
+			numberWidth,
+			r.lineHeight,
+			page,
+			"",
+			1,
+			"R",
+			false,
+			0,
+			"",
+		)
+	}
+}
@@ -0,0 +1,34 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package all registers every renderer built in to manuscript.  Import
+// it for its side effects, then use renderers.Default to find them.
+package all
+
+import (
+	_ "github.com/bieber/manuscript/bbcode"
+	_ "github.com/bieber/manuscript/epub"
+	_ "github.com/bieber/manuscript/gemtext"
+	_ "github.com/bieber/manuscript/html"
+	_ "github.com/bieber/manuscript/json"
+	_ "github.com/bieber/manuscript/latex"
+	_ "github.com/bieber/manuscript/markdown"
+	_ "github.com/bieber/manuscript/pdf"
+	_ "github.com/bieber/manuscript/rtf"
+	_ "github.com/bieber/manuscript/text"
+)
@@ -0,0 +1,63 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package all
+
+import (
+	"bytes"
+	"github.com/bieber/manuscript/parser"
+	"github.com/bieber/manuscript/renderers"
+	"strings"
+	"testing"
+)
+
+const verseSource = `@title A Story
+@authorName Someone
+@begin
+Before the verse.
+
+@verse
+The first line,
+the *second* line,
+and the last.
+@endverse
+
+After the verse.
+`
+
+func TestVerse(t *testing.T) {
+	d, err := parser.Parse(strings.NewReader(verseSource))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	for _, name := range renderers.Names() {
+		constructor, _ := renderers.Lookup(name)
+		r, err := constructor(d, map[string]string{})
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		var out bytes.Buffer
+		if err := r.Render(&out); err != nil {
+			t.Errorf("%s: Render: %v", name, err)
+		} else if out.Len() == 0 {
+			t.Errorf("%s: Render produced no output", name)
+		}
+	}
+}
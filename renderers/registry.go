@@ -0,0 +1,88 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package renderers
+
+import (
+	"sort"
+)
+
+// registration is everything the registry knows about one renderer.
+type registration struct {
+	constructor RendererConstructor
+	options     []OptionSpec
+}
+
+// registry holds every renderer that has registered itself, keyed by
+// the name used to select it on the command line.
+var registry = map[string]registration{}
+
+// Register makes a renderer available under the given name, along
+// with the options it accepts for display to the user.  The renderers
+// built in to manuscript register themselves when their packages are
+// imported, and other packages may register their own renderers the
+// same way.  Register panics if the name is already taken or the
+// constructor is nil.
+func Register(
+	name string,
+	constructor RendererConstructor,
+	options ...OptionSpec,
+) {
+	if constructor == nil {
+		panic("renderers: Register constructor is nil for " + name)
+	}
+	if _, ok := registry[name]; ok {
+		panic("renderers: Register called twice for " + name)
+	}
+	registry[name] = registration{constructor, options}
+}
+
+// Lookup returns the constructor for the renderer registered under the
+// given name, if there is one.
+func Lookup(name string) (RendererConstructor, bool) {
+	r, ok := registry[name]
+	return r.constructor, ok
+}
+
+// Options returns the options accepted by the renderer registered under
+// the given name.
+func Options(name string) []OptionSpec {
+	return registry[name].options
+}
+
+// Names returns the names of every registered renderer, sorted.
+func Names() []string {
+	names := []string{}
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Default returns the constructors for every registered renderer,
+// keyed by name, in the form expected by Resolve.  Importing
+// github.com/bieber/manuscript/renderers/all registers all of the
+// built-in renderers.
+func Default() map[string]RendererConstructor {
+	constructors := map[string]RendererConstructor{}
+	for name, r := range registry {
+		constructors[name] = r.constructor
+	}
+	return constructors
+}
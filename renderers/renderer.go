@@ -33,12 +33,28 @@ type RendererConstructor func(
 	map[string]string,
 ) (Renderer, error)
 
+// OptionSpec describes an option accepted by a renderer, for display
+// to the user.
+type OptionSpec struct {
+	Name        string
+	Default     string
+	Description string
+}
+
 // Renderer defines an object capable of rendering a document.
 // to the given output.
 type Renderer interface {
 	Render(io.Writer) error
 }
 
+// rendererPattern matches a renderer option string, a renderer's name
+// followed by an optional list of arguments in parentheses.  Quoted
+// values may span more than one line.
+var rendererPattern = regexp.MustCompile(`(?s)^(\w+)(?:\((.*)\))?$`)
+
+// optionNamePattern matches the name of a renderer's option.
+var optionNamePattern = regexp.MustCompile(`^\w+$`)
+
 // Resolve attempts to find a match for the given document and
 // renderer option string given the available set of renderer
 // constructors.  If successful, it returns the newly instantiated
@@ -48,21 +64,26 @@ func Resolve(
 	document parser.Document,
 	renderOption string,
 ) (Renderer, error) {
-	matcher := regexp.MustCompile(
-		`^(\w+)(?:\((\s*\w+\s*=\s*.+\s*(?:,\s*\w+\s*=\s*.+\s*)*)\))?$`,
+	matches := rendererPattern.FindStringSubmatch(
+		strings.TrimSpace(renderOption),
 	)
-	matches := matcher.FindStringSubmatch(renderOption)
 	if len(matches) != 3 {
 		return nil, fmt.Errorf("Invalid renderer string %s", renderOption)
 	}
 
 	rendererName := matches[1]
 	rendererArgs := map[string]string{}
-	if matches[2] != "" {
-		argSets := strings.Split(matches[2], ",")
+	if strings.TrimSpace(matches[2]) != "" {
+		argSets, err := splitArgs(matches[2])
+		if err != nil {
+			return nil, err
+		}
+
 		for _, argSet := range argSets {
-			parts := strings.Split(argSet, "=")
-			k, v := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+			k, v, err := parseArg(argSet)
+			if err != nil {
+				return nil, err
+			}
 			rendererArgs[k] = v
 		}
 	}
@@ -72,3 +93,69 @@ func Resolve(
 	}
 	return nil, fmt.Errorf("%s is not a valid renderer", rendererName)
 }
+
+// splitArgs splits a renderer's argument list on commas, except for
+// commas inside of quoted values.
+func splitArgs(args string) ([]string, error) {
+	argSets := []string{}
+	current := []rune{}
+	inQuotes, escaped := false, false
+
+	for _, r := range args {
+		if escaped {
+			escaped = false
+		} else if r == '\\' && inQuotes {
+			escaped = true
+		} else if r == '"' {
+			inQuotes = !inQuotes
+		} else if r == ',' && !inQuotes {
+			argSets = append(argSets, string(current))
+			current = []rune{}
+			continue
+		}
+		current = append(current, r)
+	}
+
+	if inQuotes {
+		return nil, fmt.Errorf("Unterminated quote in renderer option %s", args)
+	}
+	return append(argSets, string(current)), nil
+}
+
+// parseArg splits a single key=value argument.  The value may be
+// wrapped in double quotes, in which case a backslash can be used to
+// escape a quote or backslash inside it, and \n stands for a line
+// break.
+func parseArg(arg string) (k, v string, err error) {
+	parts := strings.SplitN(arg, "=", 2)
+	if len(parts) != 2 {
+		err = fmt.Errorf("Invalid renderer option %s", strings.TrimSpace(arg))
+		return
+	}
+
+	k, v = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	if !optionNamePattern.MatchString(k) {
+		err = fmt.Errorf("Invalid renderer option name %s", k)
+		return
+	}
+
+	if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		unquoted := []rune{}
+		escaped := false
+		for _, r := range v[1 : len(v)-1] {
+			if !escaped && r == '\\' {
+				escaped = true
+				continue
+			}
+			if escaped && r == 'n' {
+				r = '\n'
+			} else if escaped && r != '"' && r != '\\' {
+				unquoted = append(unquoted, '\\')
+			}
+			escaped = false
+			unquoted = append(unquoted, r)
+		}
+		v = string(unquoted)
+	}
+	return
+}
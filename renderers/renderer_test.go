@@ -0,0 +1,119 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package renderers
+
+import (
+	"github.com/bieber/manuscript/parser"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		args string
+		want []string
+	}{
+		{"a=1", []string{"a=1"}},
+		{"a=1, b=2", []string{"a=1", " b=2"}},
+		{`a="1, 2", b=3`, []string{`a="1, 2"`, " b=3"}},
+		{`a="say \"hi, there\"",b=c`, []string{`a="say \"hi, there\""`, "b=c"}},
+		{"a=\"one,\ntwo\"", []string{"a=\"one,\ntwo\""}},
+	}
+	for _, test := range tests {
+		got, err := splitArgs(test.args)
+		if err != nil {
+			t.Errorf("splitArgs(%q): %v", test.args, err)
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", test.args, got, test.want)
+		}
+	}
+
+	if _, err := splitArgs(`a="never closed, b=2`); err == nil {
+		t.Error("Unterminated quote split without an error")
+	}
+}
+
+func TestParseArg(t *testing.T) {
+	tests := []struct {
+		arg, k, v string
+	}{
+		{"a=1", "a", "1"},
+		{" path = ./css/book.css ", "path", "./css/book.css"},
+		{`glyph="* * *"`, "glyph", "* * *"},
+		{`glyph=" padded "`, "glyph", " padded "},
+		{`q="say \"hi\""`, "q", `say "hi"`},
+		{`q="back\\slash"`, "q", `back\slash`},
+		{`q="kept \t"`, "q", `kept \t`},
+		{`q="one\ntwo"`, "q", "one\ntwo"},
+		{"q=\"one\ntwo\"", "q", "one\ntwo"},
+		{`unquoted=a\nb`, "unquoted", `a\nb`},
+	}
+	for _, test := range tests {
+		k, v, err := parseArg(test.arg)
+		if err != nil {
+			t.Errorf("parseArg(%q): %v", test.arg, err)
+		} else if k != test.k || v != test.v {
+			t.Errorf(
+				"parseArg(%q) = %q, %q, want %q, %q",
+				test.arg,
+				k,
+				v,
+				test.k,
+				test.v,
+			)
+		}
+	}
+
+	for _, arg := range []string{"novalue", "bad name=1", "=1"} {
+		if _, _, err := parseArg(arg); err == nil {
+			t.Errorf("parseArg(%q) succeeded", arg)
+		}
+	}
+}
+
+type optionsRenderer map[string]string
+
+func (r optionsRenderer) Render(io.Writer) error {
+	return nil
+}
+
+func TestResolveMultiline(t *testing.T) {
+	constructors := map[string]RendererConstructor{
+		"test": func(
+			_ parser.Document,
+			options map[string]string,
+		) (Renderer, error) {
+			return optionsRenderer(options), nil
+		},
+	}
+
+	r, err := Resolve(
+		constructors,
+		parser.Document{},
+		"test(a=\"one,\ntwo\", b=\"three\\nfour\")",
+	)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	want := optionsRenderer{"a": "one,\ntwo", "b": "three\nfour"}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("got %q, want %q", r, want)
+	}
+}
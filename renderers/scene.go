@@ -0,0 +1,89 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package renderers
+
+import (
+	"fmt"
+	"github.com/bieber/manuscript/parser"
+)
+
+// BlankSceneBreak is the sceneBreak value that separates scenes with
+// an empty line instead of a glyph.
+const BlankSceneBreak = "blank"
+
+var sceneBreakAlignments = map[string]parser.Alignment{
+	"left":   parser.LeftAlignment,
+	"center": parser.CenterAlignment,
+	"right":  parser.RightAlignment,
+}
+
+// SceneSeparator describes the marker a renderer writes between two
+// scenes: the glyph itself, and where it sits on the line.
+type SceneSeparator struct {
+	Glyph     string
+	Alignment parser.Alignment
+}
+
+// NewSceneSeparator creates a SceneSeparator with the given default
+// glyph, centered.
+func NewSceneSeparator(glyph string) SceneSeparator {
+	return SceneSeparator{Glyph: glyph, Alignment: parser.CenterAlignment}
+}
+
+// Options lists the options that configure the separator, for a
+// renderer to include in its own list of options.
+func (s SceneSeparator) Options() []OptionSpec {
+	return []OptionSpec{
+		{
+			Name:        "sceneBreak",
+			Default:     s.Glyph,
+			Description: "Text marking a scene break, or blank",
+		},
+		{
+			Name:        "sceneBreakAlignment",
+			Default:     s.Alignment.String(),
+			Description: "Scene break alignment: left, center or right",
+		},
+	}
+}
+
+// Set applies one of the separator's options.  An empty sceneBreak
+// keeps the renderer's default, so the default it lists in its options
+// can always be given back to it.
+func (s *SceneSeparator) Set(option, value string) error {
+	switch option {
+	case "sceneBreak":
+		if value != "" {
+			s.Glyph = value
+		}
+	case "sceneBreakAlignment":
+		alignment, ok := sceneBreakAlignments[value]
+		if !ok {
+			return fmt.Errorf("Invalid scene break alignment %s", value)
+		}
+		s.Alignment = alignment
+	}
+	return nil
+}
+
+// Blank reports whether scenes should be separated by an empty line
+// rather than a glyph.
+func (s SceneSeparator) Blank() bool {
+	return s.Glyph == BlankSceneBreak
+}
@@ -0,0 +1,37 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package renderers
+
+import (
+	"testing"
+)
+
+func TestSceneSeparatorDefaults(t *testing.T) {
+	for _, glyph := range []string{"", "#", "* * *"} {
+		s := NewSceneSeparator(glyph)
+		for _, o := range s.Options() {
+			if err := s.Set(o.Name, o.Default); err != nil {
+				t.Errorf("%q: Set(%s, %q): %v", glyph, o.Name, o.Default, err)
+			}
+		}
+		if s != NewSceneSeparator(glyph) {
+			t.Errorf("%q: defaults changed the separator to %#v", glyph, s)
+		}
+	}
+}
@@ -0,0 +1,558 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package rtf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/bieber/manuscript/parser"
+	"github.com/bieber/manuscript/renderers"
+	"github.com/bieber/manuscript/util"
+	"github.com/dustin/go-humanize"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// All measurements in RTF are in twips, twenty to a point.
+const twipsPerInch = 1440
+
+// Every paragraph resets to plain double-spaced 12pt Courier, and then
+// adds whatever alignment or indentation it needs on top of that.
+const (
+	plain        = `\pard\plain\f0\fs24\sl480\slmult1`
+	singleSpaced = `\pard\plain\f0\fs24\sl240\slmult1`
+)
+
+// Renderer provides a Render method to render the given document to
+// an RTF file formatted in manuscript format.
+type Renderer struct {
+	labels     util.Labels
+	sceneBreak renderers.SceneSeparator
+	document   parser.Document
+	buffer     bytes.Buffer
+	inBody     bool
+}
+
+// Options lists the options accepted by New.
+var Options = append(
+	renderers.NewSceneSeparator("#").Options(),
+	util.LabelOptions...,
+)
+
+func init() {
+	renderers.Register("rtf", New, Options...)
+}
+
+// New constructs a new Renderer for the given document and
+// command-line arguments.
+func New(
+	document parser.Document,
+	options map[string]string,
+) (renderers.Renderer, error) {
+	renderer := Renderer{
+		labels:     util.DefaultLabels,
+		sceneBreak: renderers.NewSceneSeparator("#"),
+		document:   document,
+	}
+
+	for k, v := range options {
+		switch k {
+		case "sceneBreak", "sceneBreakAlignment":
+			if err := renderer.sceneBreak.Set(k, v); err != nil {
+				return nil, err
+			}
+		case "partLabel", "chapterLabel", "prologueLabel",
+			"numberStyle", "partNumberStyle", "labelSeparator":
+			if err := renderer.labels.Set(k, v); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("Invalid RTF option %s", k)
+		}
+	}
+
+	return &renderer, nil
+}
+
+// Render writes the requested document out to the specified io.Writer
+// as an RTF file.
+func (r *Renderer) Render(fout io.Writer) error {
+	r.buffer.Reset()
+
+	_, err := r.buffer.WriteString(
+		`{\rtf1\ansi\deff0{\fonttbl{\f0\fmodern Courier New;}}` + "\n" +
+			fmt.Sprintf(
+				`\paperw%d\paperh%d\margl%d\margr%d\margt%d\margb%d`+"\n",
+				17*twipsPerInch/2,
+				11*twipsPerInch,
+				twipsPerInch,
+				twipsPerInch,
+				twipsPerInch,
+				twipsPerInch,
+			),
+	)
+	if err != nil {
+		return err
+	}
+
+	// If the story starts on the title page, the first section of the
+	// document gets the running header right away.  Otherwise the
+	// header doesn't start until the first page of prose.
+	parts := r.document.Parts
+	r.inBody = len(parts) != 0 &&
+		parts[0].Anonymous &&
+		len(parts[0].Chapters) != 0 &&
+		parts[0].Chapters[0].Anonymous
+
+	section := `\sectd\titlepg{\headerf}`
+	if r.inBody {
+		section += r.header()
+	}
+	if _, err = r.buffer.WriteString(section + "\n"); err != nil {
+		return err
+	}
+
+	if err = r.writeTitle(); err != nil {
+		return err
+	}
+
+	for i, p := range parts {
+		if err = r.renderPart(p, i == 0); err != nil {
+			return err
+		}
+	}
+
+	if _, err = r.buffer.WriteString("}\n"); err != nil {
+		return err
+	}
+
+	_, err = r.buffer.WriteTo(fout)
+	return err
+}
+
+// header returns the running header for the body of the story, which
+// carries the author's name, the title and the page number.
+func (r *Renderer) header() string {
+	document := r.document
+	text := escape(document.ShortName() + " / " + document.ShortTitle)
+	return `{\header` + singleSpaced + `\qr ` + text + ` / \chpgn\par}`
+}
+
+// newPage starts a new page.  The first page of prose starts a new
+// section instead, so that page numbering can start over from one.
+func (r *Renderer) newPage(startsBody bool) error {
+	if !startsBody || r.inBody {
+		_, err := r.buffer.WriteString(`\page` + "\n")
+		return err
+	}
+
+	r.inBody = true
+	_, err := r.buffer.WriteString(
+		`\sect\sectd\pgnrestart\pgnstarts1` + r.header() + "\n",
+	)
+	return err
+}
+
+func (r *Renderer) writeParagraph(format, text string) error {
+	_, err := r.buffer.WriteString(format + " " + text + `\par` + "\n")
+	return err
+}
+
+func (r *Renderer) writeTitle() error {
+	document := r.document
+
+	words := "about " + humanize.Comma(document.WordCount()) + " words"
+
+	authorBlockLines := []string{}
+	for i, author := range document.Authors() {
+		// Each co-author's contact information follows the primary
+		// author's, separated by a blank line.
+		if i != 0 && author.Name != "" {
+			authorBlockLines = append(authorBlockLines, "")
+		}
+		if author.Name != "" {
+			authorBlockLines = append(authorBlockLines, author.Name)
+		}
+		if len(author.Address) != 0 {
+			authorBlockLines = append(authorBlockLines, author.Address...)
+		}
+		if author.PhoneNumber != "" {
+			authorBlockLines = append(authorBlockLines, author.PhoneNumber)
+		}
+		if author.EmailAddress != "" {
+			authorBlockLines = append(authorBlockLines, author.EmailAddress)
+		}
+		if len(author.ProfessionalOrgs) != 0 {
+			authorBlockLines = append(authorBlockLines, "")
+			authorBlockLines = append(
+				authorBlockLines,
+				author.ProfessionalOrgs...,
+			)
+		}
+	}
+	if len(authorBlockLines) == 0 {
+		authorBlockLines = append(authorBlockLines, "")
+	}
+
+	for i := range authorBlockLines {
+		authorBlockLines[i] = escape(authorBlockLines[i])
+	}
+
+	// Short stories get the word count in the top right corner, on the
+	// same line as the author's name.
+	if document.Type == parser.ShortStory {
+		authorBlockLines[0] += `\tab ` + escape(words)
+	}
+
+	err := r.writeParagraph(
+		fmt.Sprintf(`%s\tqr\tx%d`, singleSpaced, 13*twipsPerInch/2),
+		strings.Join(authorBlockLines, `\line `),
+	)
+	if err != nil {
+		return err
+	}
+
+	byline := "by " + document.Byline()
+	if document.Type == parser.Novel {
+		byline = "a novel " + byline
+	}
+
+	err = r.writeParagraph(
+		fmt.Sprintf(`%s\qc\sb%d`, plain, 2*twipsPerInch),
+		escape(document.Title),
+	)
+	if err != nil {
+		return err
+	}
+	if err = r.writeParagraph(plain+`\qc`, escape(byline)); err != nil {
+		return err
+	}
+
+	if !document.Date.IsZero() {
+		err = r.writeParagraph(
+			plain+`\qc`,
+			escape(document.Date.Format("January 2, 2006")),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if document.Type == parser.Novel {
+		err = r.writeParagraph(
+			fmt.Sprintf(`%s\qc\sb%d`, plain, 3*twipsPerInch),
+			escape(words),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Renderer) renderPart(part parser.Part, firstInDocument bool) error {
+	if !part.Anonymous {
+		startsBody := len(part.Chapters) != 0 && part.Chapters[0].Anonymous
+		if err := r.newPage(startsBody); err != nil {
+			return err
+		}
+
+		err := r.writeParagraph(
+			fmt.Sprintf(`%s\qc\sb%d`, plain, 3*twipsPerInch),
+			escape(r.labels.PartLabel(part.Number, part.Title)),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	firstChapter := !firstInDocument
+	for _, c := range part.Chapters {
+		if err := r.renderChapter(c, firstChapter); err != nil {
+			return err
+		}
+		firstChapter = false
+	}
+
+	return nil
+}
+
+func (r *Renderer) renderChapter(
+	chapter parser.Chapter,
+	firstInPart bool,
+) error {
+	if !chapter.Anonymous {
+		if !firstInPart {
+			if err := r.newPage(true); err != nil {
+				return err
+			}
+		}
+
+		label := r.labels.ChapterHeading(chapter.Number)
+		if chapter.Prologue {
+			label = r.labels.Prologue
+		}
+
+		err := r.writeParagraph(
+			fmt.Sprintf(`%s\qc\sb%d`, plain, 3*twipsPerInch),
+			escape(label),
+		)
+		if err != nil {
+			return err
+		}
+
+		if chapter.Title != "" {
+			err = r.writeParagraph(plain+`\qc`, escape(chapter.Title))
+			if err != nil {
+				return err
+			}
+		}
+
+		if err = r.writeParagraph(plain, ""); err != nil {
+			return err
+		}
+	}
+
+	if chapter.Epigraph != nil {
+		if err := r.renderEpigraph(*chapter.Epigraph); err != nil {
+			return err
+		}
+	}
+
+	for i, s := range chapter.Scenes {
+		if err := r.renderScene(s); err != nil {
+			return err
+		}
+
+		if i != len(chapter.Scenes)-1 {
+			if err := r.renderSceneBreak(s.BreakLabel); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *Renderer) renderSceneBreak(label string) error {
+	var err error
+	if r.sceneBreak.Blank() {
+		err = r.writeParagraph(plain, "")
+	} else {
+		err = r.writeParagraph(
+			plain+alignmentControl(r.sceneBreak.Alignment),
+			escape(r.sceneBreak.Glyph),
+		)
+	}
+	if err != nil || label == "" {
+		return err
+	}
+
+	return r.writeParagraph(plain+`\qc`, `{\i `+escape(label)+`}`)
+}
+
+func (r *Renderer) renderEpigraph(epigraph parser.Epigraph) error {
+	err := r.writeParagraph(
+		plain+`\qr`,
+		`{\i `+escape(epigraph.Text)+`}`,
+	)
+	if err != nil {
+		return err
+	}
+
+	if epigraph.Attribution != "" {
+		err = r.writeParagraph(plain+`\qr`, escape("— "+epigraph.Attribution))
+	}
+	return err
+}
+
+func (r *Renderer) renderScene(scene parser.Scene) error {
+	for _, s := range scene.Sections {
+		if err := r.renderSection(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Renderer) renderSection(section parser.Section) error {
+	if section.Title != "" {
+		err := r.writeParagraph(
+			plain+`\qc`,
+			`{\b `+escape(section.Title)+`}`,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, p := range section.Paragraphs {
+		if err := r.renderParagraph(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Renderer) renderParagraph(paragraph parser.Paragraph) error {
+	if !paragraph.RenderedBy("rtf") {
+		return nil
+	}
+	if verse, ok := paragraph.Verse(); ok {
+		return r.renderVerse(verse)
+	}
+	if raw, ok := paragraph.Raw(); ok {
+		return r.renderRaw(raw)
+	}
+	if block, ok := paragraph.Conditional(); ok {
+		for _, p := range block.Paragraphs {
+			if err := r.renderParagraph(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// There's no way to hide text here, so spoilers are shown as they
+	// are.
+	if spoiler, ok := paragraph.Spoiler(); ok {
+		for _, p := range spoiler.Paragraphs {
+			if err := r.renderParagraph(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if image, ok := paragraph.Image(); ok {
+		return r.renderImage(image)
+	}
+
+	text := ""
+	for _, e := range paragraph.Text {
+		text += r.renderElement(e)
+	}
+
+	format := fmt.Sprintf(`%s\fi%d`, plain, twipsPerInch/2)
+	if paragraph.Alignment != parser.DefaultAlignment {
+		format = plain + alignmentControl(paragraph.Alignment)
+	}
+	return r.writeParagraph(format, text)
+}
+
+// alignmentControl returns the control word that aligns a paragraph
+// as given.
+func alignmentControl(alignment parser.Alignment) string {
+	switch alignment {
+	case parser.CenterAlignment:
+		return `\qc`
+	case parser.RightAlignment:
+		return `\qr`
+	}
+	return `\ql`
+}
+
+// renderRaw writes out a raw block exactly as it was written.
+func (r *Renderer) renderRaw(raw parser.RawBlock) error {
+	_, err := r.buffer.WriteString(raw.Content + "\n")
+	return err
+}
+
+// Images aren't embedded in manuscripts, so we just leave a note
+// saying where each one goes.
+func (r *Renderer) renderImage(image parser.Image) error {
+	text := "[Image: " + image.Path + "]"
+	if image.Caption != "" {
+		text = "[Image: " + image.Caption + "]"
+	}
+
+	return r.writeParagraph(plain+`\qc`, escape(text))
+}
+
+func (r *Renderer) renderVerse(verse parser.VerseBlock) error {
+	lines := []string{}
+	for _, line := range verse.Lines {
+		text := ""
+		for _, e := range line {
+			text += r.renderElement(e)
+		}
+		lines = append(lines, text)
+	}
+
+	return r.writeParagraph(
+		fmt.Sprintf(`%s\li%d`, plain, twipsPerInch/2),
+		strings.Join(lines, `\line `),
+	)
+}
+
+func (r *Renderer) renderElement(element parser.DocumentElement) string {
+	switch e := element.(type) {
+	case parser.PlainText:
+		return escape(string(e))
+	case parser.ItalicText:
+		return `{\i ` + escape(string(e)) + `}`
+	case parser.BoldText:
+		return `{\b ` + escape(string(e)) + `}`
+	case parser.BoldItalicText:
+		return `{\b\i ` + escape(string(e)) + `}`
+	case parser.Footnote:
+		return escape(" (" + string(e) + ")")
+	case parser.UnderlineText:
+		return `{\ul ` + escape(string(e)) + `}`
+	case parser.StrikethroughText:
+		return `{\strike ` + r.renderElement(e.Text) + `}`
+	case parser.ColoredText:
+		return r.renderElement(e.Text)
+	default:
+		panic(
+			errors.New(
+				"rtf: Unexpected document element passed to renderElement",
+			),
+		)
+	}
+}
+
+// escape makes text safe to include in an RTF document.  RTF itself
+// is 7-bit, so anything outside of ASCII is written out as a \u
+// control word with its UTF-16 code units.  RTF ignores plain line
+// breaks, so they're written as \line.
+func escape(text string) string {
+	buf := bytes.Buffer{}
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '{' || r == '}':
+			buf.WriteRune('\\')
+			buf.WriteRune(r)
+		case r == parser.SoftHyphen:
+			buf.WriteString(`\-`)
+		case r == parser.NonBreakingSpace:
+			buf.WriteString(`\~`)
+		case r == '\n':
+			buf.WriteString(`\line `)
+		case r < 0x80:
+			buf.WriteRune(r)
+		default:
+			for _, u := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&buf, `\u%d?`, int16(u))
+			}
+		}
+	}
+	return buf.String()
+}
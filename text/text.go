@@ -0,0 +1,415 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package text
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/bieber/manuscript/parser"
+	"github.com/bieber/manuscript/renderers"
+	"github.com/bieber/manuscript/util"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Renderer provides a Render method to render the given document to
+// plain text.
+type Renderer struct {
+	markSpans  bool
+	width      int
+	labels     util.Labels
+	sceneBreak renderers.SceneSeparator
+	document   parser.Document
+	buffer     bytes.Buffer
+}
+
+// Options lists the options accepted by New.
+var Options = append(
+	[]renderers.OptionSpec{
+		{
+			Name:        "width",
+			Default:     "80",
+			Description: "Column to wrap lines at, or 0 for no wrapping",
+		},
+		{
+			Name:        "markSpans",
+			Default:     "false",
+			Description: "Mark italic and bold text with _ and *",
+		},
+	},
+	append(
+		renderers.NewSceneSeparator("#").Options(),
+		util.LabelOptions...,
+	)...,
+)
+
+func init() {
+	renderers.Register("text", New, Options...)
+}
+
+// New constructs a new Renderer for the given document and
+// command-line arguments.
+func New(
+	document parser.Document,
+	options map[string]string,
+) (renderers.Renderer, error) {
+	renderer := Renderer{
+		width:      80,
+		labels:     util.DefaultLabels,
+		sceneBreak: renderers.NewSceneSeparator("#"),
+		document:   document,
+	}
+
+	for k, v := range options {
+		switch k {
+		case "markSpans":
+			renderer.markSpans = util.ArgIsTrue(v)
+		case "width":
+			width, err := strconv.Atoi(v)
+			if err != nil || width < 0 {
+				return nil, fmt.Errorf("Invalid text width %s", v)
+			}
+			renderer.width = width
+		case "sceneBreak", "sceneBreakAlignment":
+			if err := renderer.sceneBreak.Set(k, v); err != nil {
+				return nil, err
+			}
+		case "partLabel", "chapterLabel", "prologueLabel",
+			"numberStyle", "partNumberStyle", "labelSeparator":
+			if err := renderer.labels.Set(k, v); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("Invalid text option %s", k)
+		}
+	}
+
+	return &renderer, nil
+}
+
+// Render writes the requested document out to the specified io.Writer
+// as plain text.
+func (r *Renderer) Render(fout io.Writer) error {
+	for _, p := range r.document.Parts {
+		err := r.renderPart(p)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := r.buffer.WriteTo(fout)
+	return err
+}
+
+func (r *Renderer) renderPart(part parser.Part) error {
+	if !part.Anonymous {
+		text := r.labels.PartLabel(part.Number, part.Title)
+		_, err := r.buffer.WriteString(r.wrapHeading(text) + "\n\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, c := range part.Chapters {
+		err := r.renderChapter(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Renderer) renderChapter(chapter parser.Chapter) error {
+	if !chapter.Anonymous {
+		text := ""
+		if chapter.Prologue {
+			text = r.labels.PrologueLabel(chapter.Title)
+		} else {
+			text = r.labels.ChapterLabel(chapter.Number, chapter.Title)
+		}
+
+		_, err := r.buffer.WriteString(r.wrapHeading(text) + "\n\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	if chapter.Epigraph != nil {
+		err := r.renderEpigraph(*chapter.Epigraph)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, s := range chapter.Scenes {
+		err := r.renderScene(s)
+		if err != nil {
+			return err
+		}
+
+		if i != len(chapter.Scenes)-1 {
+			err := r.renderSceneBreak(s.BreakLabel)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *Renderer) renderSceneBreak(label string) error {
+	text := ""
+	if !r.sceneBreak.Blank() {
+		text = r.wrap(r.sceneBreak.Glyph)
+		if r.width != 0 {
+			text = r.align(text, r.sceneBreak.Alignment)
+		}
+		text += "\n"
+	}
+	text += "\n"
+
+	if label != "" {
+		labelText := r.wrap(label)
+		if r.width != 0 {
+			labelText = r.align(labelText, parser.CenterAlignment)
+		}
+		text += labelText + "\n\n"
+	}
+
+	_, err := r.buffer.WriteString(text)
+	return err
+}
+
+func (r *Renderer) renderEpigraph(epigraph parser.Epigraph) error {
+	text := r.wrap(epigraph.Text) + "\n"
+	if epigraph.Attribution != "" {
+		text += r.wrap("— "+epigraph.Attribution) + "\n"
+	}
+
+	_, err := r.buffer.WriteString(text + "\n")
+	return err
+}
+
+func (r *Renderer) renderScene(scene parser.Scene) error {
+	for _, s := range scene.Sections {
+		err := r.renderSection(s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Renderer) renderSection(section parser.Section) error {
+	if section.Title != "" {
+		_, err := r.buffer.WriteString(r.wrap(section.Title) + "\n\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, p := range section.Paragraphs {
+		err := r.renderParagraph(p)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Renderer) renderParagraph(paragraph parser.Paragraph) error {
+	if !paragraph.RenderedBy("text") {
+		return nil
+	}
+	if verse, ok := paragraph.Verse(); ok {
+		return r.renderVerse(verse)
+	}
+	if raw, ok := paragraph.Raw(); ok {
+		return r.renderRaw(raw)
+	}
+	if block, ok := paragraph.Conditional(); ok {
+		for _, p := range block.Paragraphs {
+			if err := r.renderParagraph(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// There's no way to hide text here, so spoilers are shown as they
+	// are.
+	if spoiler, ok := paragraph.Spoiler(); ok {
+		for _, p := range spoiler.Paragraphs {
+			if err := r.renderParagraph(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if image, ok := paragraph.Image(); ok {
+		return r.renderImage(image)
+	}
+
+	text := ""
+	for _, e := range paragraph.Text {
+		text += r.renderElement(e)
+	}
+
+	text = r.wrap(text)
+	if r.width != 0 {
+		text = r.align(text, paragraph.Alignment)
+	}
+
+	_, err := r.buffer.WriteString(text + "\n\n")
+	return err
+}
+
+// align pads each line of already wrapped text with spaces to center
+// or right-align it within the renderer's width.
+func (r *Renderer) align(text string, alignment parser.Alignment) string {
+	if alignment != parser.CenterAlignment &&
+		alignment != parser.RightAlignment {
+		return text
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		padding := r.width - utf8.RuneCountInString(line)
+		if alignment == parser.CenterAlignment {
+			padding /= 2
+		}
+		if padding > 0 {
+			lines[i] = strings.Repeat(" ", padding) + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderRaw writes out a raw block exactly as it was written.
+func (r *Renderer) renderRaw(raw parser.RawBlock) error {
+	_, err := r.buffer.WriteString(raw.Content + "\n\n")
+	return err
+}
+
+// There's no way to show an image in plain text, so we just leave a
+// note saying where it goes.
+func (r *Renderer) renderImage(image parser.Image) error {
+	text := "[Image: " + image.Path + "]"
+	if image.Caption != "" {
+		text = "[Image: " + image.Caption + "]"
+	}
+
+	_, err := r.buffer.WriteString(r.wrap(text) + "\n\n")
+	return err
+}
+
+// Each line of verse is wrapped on its own, so that the original line
+// breaks are kept.
+func (r *Renderer) renderVerse(verse parser.VerseBlock) error {
+	lines := []string{}
+	for _, line := range verse.Lines {
+		text := ""
+		for _, e := range line {
+			text += r.renderElement(e)
+		}
+		lines = append(lines, r.wrap(text))
+	}
+
+	_, err := r.buffer.WriteString(strings.Join(lines, "\n") + "\n\n")
+	return err
+}
+
+func (r *Renderer) renderElement(element parser.DocumentElement) string {
+	italic, bold := "", ""
+	if r.markSpans {
+		italic, bold = "_", "*"
+	}
+
+	switch e := element.(type) {
+	case parser.PlainText:
+		return string(e)
+	case parser.ItalicText:
+		return italic + string(e) + italic
+	case parser.BoldText:
+		return bold + string(e) + bold
+	case parser.BoldItalicText:
+		return bold + italic + string(e) + italic + bold
+	case parser.Footnote:
+		return " (" + string(e) + ")"
+	case parser.UnderlineText:
+		return italic + string(e) + italic
+	case parser.StrikethroughText:
+		return r.renderElement(e.Text)
+	case parser.ColoredText:
+		return r.renderElement(e.Text)
+	default:
+		panic(
+			errors.New(
+				"text: Unexpected document element passed to renderElement",
+			),
+		)
+	}
+}
+
+// wrap reflows text to fit within the renderer's width.  Words longer
+// than the width are left on lines of their own rather than split.
+// wrapHeading wraps a part or chapter heading, keeping any line break
+// from the label separator.
+func (r *Renderer) wrapHeading(text string) string {
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		lines = append(lines, r.wrap(line))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *Renderer) wrap(text string) string {
+	// Plain text has no way to hyphenate a word only when it's needed.
+	text = strings.Replace(text, string(parser.SoftHyphen), "", -1)
+	words := util.Words(text)
+	if r.width == 0 {
+		return strings.Join(words, " ")
+	}
+
+	lines := []string{}
+	line, lineWidth := "", 0
+	for _, word := range words {
+		wordWidth := utf8.RuneCountInString(word)
+		if lineWidth != 0 && lineWidth+1+wordWidth > r.width {
+			lines = append(lines, line)
+			line, lineWidth = "", 0
+		}
+
+		if lineWidth != 0 {
+			line += " "
+			lineWidth++
+		}
+		line += word
+		lineWidth += wordWidth
+	}
+	if lineWidth != 0 {
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
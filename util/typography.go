@@ -0,0 +1,191 @@
+/* Copyright (c) 2016 Robert Bieber
+ *
+ * This file is part of manuscript.
+ *
+ * manuscript is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bieber/manuscript/parser"
+	"strings"
+	"unicode"
+)
+
+var dashReplacer = strings.NewReplacer(
+	"---", "—",
+	"--", "–",
+	"...", "…",
+)
+
+// QuoteStyle gives the marks a language uses to open and close
+// dialogue, and to open and close a quotation nested inside it.
+type QuoteStyle struct {
+	Open, Close           rune
+	InnerOpen, InnerClose rune
+}
+
+// QuoteStyles lists the quote styles that can be chosen by name.
+var QuoteStyles = map[string]QuoteStyle{
+	"english": {'“', '”', '‘', '’'},
+	"german":  {'„', '“', '‚', '‘'},
+	"french":  {'«', '»', '‹', '›'},
+}
+
+// ParseQuoteStyle looks up a quote style by the name given in a
+// renderer option.  An empty name or "none" leaves the quotes alone,
+// and gives a nil style.
+func ParseQuoteStyle(name string) (*QuoteStyle, error) {
+	if name == "" || strings.ToLower(name) == "none" {
+		return nil, nil
+	}
+	style, ok := QuoteStyles[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("Invalid dialogue style %s", name)
+	}
+	return &style, nil
+}
+
+// Typographer converts straight quotes, dashes and ellipses into their
+// typographic equivalents.  It remembers the last character it saw so
+// that a quote at the beginning of one element can still be turned
+// the right way based on the end of the element before it.
+//
+// Curly turns on curly quotes, dashes and ellipses.  Dialogue, if set,
+// gives the marks that double quotes are turned into instead, and the
+// marks for single quotes nested inside them.
+type Typographer struct {
+	Curly    bool
+	Dialogue *QuoteStyle
+
+	last     rune
+	inDouble bool
+	inSingle bool
+}
+
+// Element converts the text of a single element, continuing from the
+// elements passed in before it.
+func (t *Typographer) Element(
+	element parser.DocumentElement,
+) parser.DocumentElement {
+	switch e := element.(type) {
+	case parser.PlainText:
+		return parser.PlainText(t.text(string(e)))
+	case parser.ItalicText:
+		return parser.ItalicText(t.text(string(e)))
+	case parser.BoldText:
+		return parser.BoldText(t.text(string(e)))
+	case parser.BoldItalicText:
+		return parser.BoldItalicText(t.text(string(e)))
+	case parser.UnderlineText:
+		return parser.UnderlineText(t.text(string(e)))
+	case parser.StrikethroughText:
+		return parser.StrikethroughText{Text: t.Element(e.Text)}
+	case parser.ColoredText:
+		return parser.ColoredText{Color: e.Color, Text: t.Element(e.Text)}
+	case parser.Footnote:
+		// Footnotes are read separately from the text around them,
+		// so they get their own quotes.
+		notes := Typographer{Curly: t.Curly, Dialogue: t.Dialogue}
+		return parser.Footnote(notes.text(string(e)))
+	default:
+		panic(
+			errors.New(
+				"util: Unexpected document element passed to Typographer",
+			),
+		)
+	}
+}
+
+// LineBreak tells the typographer that a line of verse has ended, so
+// that a quote at the start of the next line opens.
+func (t *Typographer) LineBreak() {
+	t.last = '\n'
+}
+
+func (t *Typographer) text(text string) string {
+	if t.Curly {
+		text = dashReplacer.Replace(text)
+	}
+
+	runes := []rune(text)
+	converted := []rune{}
+	for i, r := range runes {
+		if t.Dialogue != nil && r == '"' {
+			r = t.Dialogue.Close
+			if t.opensQuote() {
+				r = t.Dialogue.Open
+			}
+			t.inDouble, t.inSingle = r == t.Dialogue.Open, false
+		} else if t.Dialogue != nil && r == '\'' && t.inDouble {
+			r = t.nestedQuote(runes, i)
+		} else if t.Curly && r == '"' {
+			r = '”'
+			if t.opensQuote() {
+				r = '“'
+			}
+		} else if t.Curly && r == '\'' {
+			r = '’'
+			if t.opensQuote() {
+				r = '‘'
+			}
+		}
+
+		converted = append(converted, r)
+		t.last = r
+	}
+	return string(converted)
+}
+
+// nestedQuote converts a single quote inside of dialogue.  It opens a
+// nested quotation where a quote would open, and closes one that's
+// already open unless it's followed by a letter, as in "don't".  Any
+// other single quote is an apostrophe.
+func (t *Typographer) nestedQuote(runes []rune, i int) rune {
+	if t.opensQuote() {
+		t.inSingle = true
+		return t.Dialogue.InnerOpen
+	}
+
+	followedByLetter := i+1 < len(runes) && unicode.IsLetter(runes[i+1])
+	if t.inSingle && !followedByLetter {
+		t.inSingle = false
+		return t.Dialogue.InnerClose
+	}
+
+	if t.Curly {
+		return '’'
+	}
+	return '\''
+}
+
+// A quote opens if it comes at the start of the paragraph or after
+// whitespace, opening punctuation or a dash.  Anything else, including
+// an apostrophe in the middle of a word, closes.
+func (t *Typographer) opensQuote() bool {
+	openers := "([{“‘—–"
+	if t.Dialogue != nil {
+		// Some languages close quotes with marks that open them in
+		// English, so only the chosen style's opening marks count.
+		openers = "([{—–" + string(t.Dialogue.Open) +
+			string(t.Dialogue.InnerOpen)
+	}
+
+	return t.last == 0 ||
+		unicode.IsSpace(t.last) ||
+		strings.ContainsRune(openers, t.last)
+}
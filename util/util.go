@@ -21,31 +21,331 @@ package util
 import (
 	"fmt"
 	"github.com/StefanSchroeder/Golang-Roman"
+	"github.com/bieber/manuscript/parser"
+	"github.com/bieber/manuscript/renderers"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
-// PartLabel assembles a label for a document part.
-func PartLabel(number int, title string) string {
-	text := "Part " + roman.Roman(number)
-	if title != "" {
-		text += ": " + title
+// ArgIsTrue reports whether a renderer option value should be read as
+// true.
+func ArgIsTrue(arg string) bool {
+	arg = strings.ToLower(arg)
+	return arg == "t" || arg == "true" || arg == "yes" || arg == "y"
+}
+
+// LabelOptions lists the renderer options that override the words
+// used to label parts, chapters and prologues, and the way parts and
+// chapters are numbered.  Renderers that accept
+// them pass them on to Labels.Set.
+var LabelOptions = []renderers.OptionSpec{
+	{
+		Name:        "partLabel",
+		Default:     DefaultLabels.Part,
+		Description: "Word used to label parts",
+	},
+	{
+		Name:        "chapterLabel",
+		Default:     DefaultLabels.Chapter,
+		Description: "Word used to label chapters",
+	},
+	{
+		Name:        "prologueLabel",
+		Default:     DefaultLabels.Prologue,
+		Description: "Word used to label prologues",
+	},
+	{
+		Name:        "numberStyle",
+		Default:     DefaultLabels.ChapterNumbers,
+		Description: "Chapter numbers: arabic, roman or words",
+	},
+	{
+		Name:        "partNumberStyle",
+		Default:     DefaultLabels.PartNumbers,
+		Description: "Part numbers: arabic, roman or words",
+	},
+	{
+		Name:        "labelSeparator",
+		Default:     DefaultLabels.Separator,
+		Description: "Text between a label's number and its title",
+	},
+}
+
+// Labels holds the words used to label parts, chapters and
+// prologues, so that they can be translated or replaced, along with
+// the number styles used for parts and chapters and the separator
+// that joins a heading to its title.
+type Labels struct {
+	Part           string
+	Chapter        string
+	Prologue       string
+	PartNumbers    string
+	ChapterNumbers string
+	Separator      string
+}
+
+// DefaultLabels are the labels used unless a renderer is told
+// otherwise.
+var DefaultLabels = Labels{
+	Part:           "Part",
+	Chapter:        "Chapter",
+	Prologue:       "Prologue",
+	PartNumbers:    "roman",
+	ChapterNumbers: "arabic",
+	Separator:      ": ",
+}
+
+// Set overrides one of the labels given the name of the renderer
+// option for it.
+func (l *Labels) Set(option, value string) error {
+	switch option {
+	case "partLabel":
+		l.Part = value
+	case "chapterLabel":
+		l.Chapter = value
+	case "prologueLabel":
+		l.Prologue = value
+	case "labelSeparator":
+		l.Separator = value
+	case "numberStyle", "partNumberStyle":
+		if value != "arabic" && value != "roman" && value != "words" {
+			return fmt.Errorf("Invalid number style %s", value)
+		}
+		if option == "numberStyle" {
+			l.ChapterNumbers = value
+		} else {
+			l.PartNumbers = value
+		}
 	}
-	return text
+	return nil
+}
+
+// PartHeading assembles the numbered heading for a part, without its
+// title.
+func (l Labels) PartHeading(number int) string {
+	return strings.TrimSpace(
+		l.Part + " " + FormatNumber(number, l.PartNumbers),
+	)
+}
+
+// ChapterHeading assembles the numbered heading for a chapter,
+// without its title.
+func (l Labels) ChapterHeading(number int) string {
+	return strings.TrimSpace(
+		l.Chapter + " " + FormatNumber(number, l.ChapterNumbers),
+	)
+}
+
+// PartLabel assembles a label for a document part.
+func (l Labels) PartLabel(number int, title string) string {
+	return l.withTitle(l.PartHeading(number), title)
 }
 
 // PrologueLabel assembles a label for a prologue.
-func PrologueLabel(title string) string {
-	text := "Prologue"
-	if title != "" {
-		text += ": " + title
-	}
-	return text
+func (l Labels) PrologueLabel(title string) string {
+	return l.withTitle(l.Prologue, title)
 }
 
 // ChapterLabel assembles a label for a chapter.
-func ChapterLabel(number int, title string) string {
-	text := fmt.Sprintf("Chapter %d", number)
-	if title != "" {
-		text += ": " + title
+func (l Labels) ChapterLabel(number int, title string) string {
+	return l.withTitle(l.ChapterHeading(number), title)
+}
+
+func (l Labels) withTitle(label, title string) string {
+	if title == "" {
+		return label
+	}
+	if label == "" {
+		return title
+	}
+	return label + l.Separator + title
+}
+
+// OneLine joins the lines of a label that has a line break for its
+// separator with spaces, for places like bookmarks and tables of
+// contents where it has to fit on a single line.
+func OneLine(label string) string {
+	return strings.Replace(label, "\n", " ", -1)
+}
+
+var (
+	numberWords = []string{
+		"Zero", "One", "Two", "Three", "Four", "Five", "Six", "Seven",
+		"Eight", "Nine", "Ten", "Eleven", "Twelve", "Thirteen",
+		"Fourteen", "Fifteen", "Sixteen", "Seventeen", "Eighteen",
+		"Nineteen",
+	}
+	tensWords = []string{
+		"", "", "Twenty", "Thirty", "Forty", "Fifty", "Sixty", "Seventy",
+		"Eighty", "Ninety",
+	}
+)
+
+// SceneNumber gives the number of the scene at the given index in a
+// chapter, as in "1.2" for the second scene of the first chapter.
+// Scenes in prologues and unnamed chapters are only numbered by their
+// position.
+func SceneNumber(chapter parser.Chapter, index int) string {
+	if chapter.Anonymous || chapter.Prologue {
+		return strconv.Itoa(index + 1)
+	}
+	return fmt.Sprintf("%d.%d", chapter.Number, index+1)
+}
+
+// SplitFirstLetter splits the elements of a paragraph after its first
+// letter, for renderers that set that letter apart as a drop cap.  Any
+// quotation marks in front of the letter go along with it, and both
+// halves keep their formatting, so a paragraph starting with italics
+// gives an italic letter.  It fails if the paragraph starts with a
+// footnote or with anything other than a word.
+func SplitFirstLetter(
+	elements []parser.DocumentElement,
+) (first, rest []parser.DocumentElement, ok bool) {
+	for i, e := range elements {
+		head, tail, found, fits := splitLetter(e)
+		if !fits {
+			return nil, nil, false
+		}
+		if head != nil {
+			first = append(first, head)
+		}
+		if found {
+			if tail != nil {
+				rest = append(rest, tail)
+			}
+			return first, append(rest, elements[i+1:]...), true
+		}
+	}
+	return nil, nil, false
+}
+
+// splitLetter splits a single element after its first letter.  If it
+// has no letter, found is false, and fits reports whether the letter
+// could still come in a later element, which is only the case if this
+// one is empty or holds nothing but punctuation.
+func splitLetter(
+	element parser.DocumentElement,
+) (head, tail parser.DocumentElement, found, fits bool) {
+	text := ""
+	switch e := element.(type) {
+	case parser.PlainText:
+		text = string(e)
+	case parser.ItalicText:
+		text = string(e)
+	case parser.BoldText:
+		text = string(e)
+	case parser.BoldItalicText:
+		text = string(e)
+	case parser.UnderlineText:
+		text = string(e)
+	case parser.StrikethroughText:
+		head, tail, found, fits = splitLetter(e.Text)
+		if head != nil {
+			head = parser.StrikethroughText{Text: head}
+		}
+		if tail != nil {
+			tail = parser.StrikethroughText{Text: tail}
+		}
+		return
+	case parser.ColoredText:
+		head, tail, found, fits = splitLetter(e.Text)
+		if head != nil {
+			head = parser.ColoredText{Color: e.Color, Text: head}
+		}
+		if tail != nil {
+			tail = parser.ColoredText{Color: e.Color, Text: tail}
+		}
+		return
+	default:
+		return nil, nil, false, false
+	}
+
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			return nil, nil, false, false
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			end := i + utf8.RuneLen(r)
+			head = withText(element, text[:end])
+			if end != len(text) {
+				tail = withText(element, text[end:])
+			}
+			return head, tail, true, true
+		}
+	}
+
+	if text != "" {
+		head = element
+	}
+	return head, nil, false, true
+}
+
+// withText returns an element formatted the same way as the given one,
+// but holding different text.
+func withText(
+	element parser.DocumentElement,
+	text string,
+) parser.DocumentElement {
+	switch element.(type) {
+	case parser.ItalicText:
+		return parser.ItalicText(text)
+	case parser.BoldText:
+		return parser.BoldText(text)
+	case parser.BoldItalicText:
+		return parser.BoldItalicText(text)
+	case parser.UnderlineText:
+		return parser.UnderlineText(text)
+	}
+	return parser.PlainText(text)
+}
+
+// FormatNumber writes out a part or chapter number in the given
+// style: arabic numerals, roman numerals, or words.
+func FormatNumber(number int, style string) string {
+	switch style {
+	case "roman":
+		return roman.Roman(number)
+	case "words":
+		return spellNumber(number)
+	}
+	return strconv.Itoa(number)
+}
+
+// spellNumber writes out a number in words, as in "Twenty-One".
+func spellNumber(number int) string {
+	switch {
+	case number < 0:
+		return "Minus " + spellNumber(-number)
+	case number < 20:
+		return numberWords[number]
+	case number < 100:
+		text := tensWords[number/10]
+		if number%10 != 0 {
+			text += "-" + numberWords[number%10]
+		}
+		return text
+	case number < 1000:
+		text := numberWords[number/100] + " Hundred"
+		if number%100 != 0 {
+			text += " " + spellNumber(number%100)
+		}
+		return text
+	}
+
+	text := spellNumber(number/1000) + " Thousand"
+	if number%1000 != 0 {
+		text += " " + spellNumber(number%1000)
 	}
 	return text
 }
+
+// Words splits text into words at runs of whitespace, like
+// strings.Fields, except that non-breaking spaces hold the words on
+// either side of them together.
+func Words(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) && r != parser.NonBreakingSpace
+	})
+}